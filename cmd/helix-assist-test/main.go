@@ -49,7 +49,7 @@ func main() {
 		os.Exit(1)
 	}
 
-	logger := lsp.NewLogger("/dev/null")
+	logger := lsp.NewLogger(lsp.LoggerOptions{})
 	defer logger.Close()
 
 	registry := providers.NewRegistry()
@@ -62,6 +62,7 @@ func main() {
 		openaiProvider := providers.NewOpenAIProvider(
 			*openaiKey,
 			*openaiModel,
+			"",
 			*openaiEndpoint,
 			*timeoutMs,
 			logger,
@@ -79,6 +80,7 @@ func main() {
 		anthropicProvider := providers.NewAnthropicProvider(
 			*anthropicKey,
 			*anthropicModel,
+			"",
 			*anthropicEndpoint,
 			*timeoutMs,
 			logger,
@@ -3,13 +3,19 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
+	"syscall"
 
 	"github.com/leona/helix-assist/internal/config"
 	"github.com/leona/helix-assist/internal/handlers"
 	"github.com/leona/helix-assist/internal/lsp"
 	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/util"
 )
 
 var Version = "dev"
@@ -17,17 +23,50 @@ var Version = "dev"
 func main() {
 	cfg := config.Load()
 
+	if cfg.ReplayFile != "" {
+		os.Exit(replay(cfg))
+	}
+
 	if err := cfg.Validate(); err != nil {
 		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	logger := lsp.NewLogger(cfg.LogFile)
+	if err := cfg.LoadLanguages(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if _, err := util.NewPipeline(cfg.DisabledProcessors); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
 	defer logger.Close()
 	logger.Log("Starting helix-assist", "handler:", cfg.Handler)
-	logger.Log("triggerCharacters:", cfg.TriggerCharacters)
+	logger.Log("triggerCharacters:", cfg.AllTriggerCharacters(), "language overrides:", len(cfg.Languages))
 	registry := providers.NewRegistry()
 
+	var trace *lsp.Trace
+
+	if cfg.RecordFile != "" {
+		trace, err = lsp.NewTrace(cfg.RecordFile)
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Record error: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+		defer trace.Close()
+		logger.Log("Recording session to", cfg.RecordFile)
+	}
+
 	if cfg.OpenAIKey != "" {
 		openaiProvider := providers.NewOpenAIProvider(
 			cfg.OpenAIKey,
@@ -37,7 +76,7 @@ func main() {
 			cfg.FetchTimeout,
 			logger,
 		)
-		registry.Register("openai", openaiProvider)
+		registry.Register("openai", withTrace(openaiProvider, trace))
 		chatModel := cfg.OpenAIModelForChat
 		if chatModel == "" {
 			chatModel = cfg.OpenAIModel
@@ -54,7 +93,7 @@ func main() {
 			cfg.FetchTimeout,
 			logger,
 		)
-		registry.Register("anthropic", anthropicProvider)
+		registry.Register("anthropic", withTrace(anthropicProvider, trace))
 		chatModel := cfg.AnthropicModelForChat
 		if chatModel == "" {
 			chatModel = cfg.AnthropicModel
@@ -73,26 +112,120 @@ func main() {
 		return
 	}
 
+	if cfg.Listen != "" {
+		serve(cfg, registry, logger, trace)
+		return
+	}
+
+	svc := newService(cfg, registry, logger, os.Stdin, os.Stdout)
+	svc.SetTrace(trace)
+	logger.Log("LSP service initialized, listening on stdin")
+
+	if err := svc.Start(); err != nil {
+		logger.Error("LSP service error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func newService(cfg *config.Config, registry *providers.Registry, logger *lsp.Logger, in io.Reader, out io.Writer) *lsp.Service {
 	capabilities := lsp.ServerCapabilities{
-		TextDocumentSync: 1,
+		TextDocumentSync: lsp.TextDocumentSyncOptions{
+			OpenClose: true,
+			Change:    lsp.TextDocumentSyncIncremental,
+			Save:      &lsp.SaveOptions{IncludeText: false},
+		},
 		CompletionProvider: &lsp.CompletionOptions{
-			TriggerCharacters: cfg.TriggerCharacters,
+			TriggerCharacters: cfg.AllTriggerCharacters(),
 		},
 		CodeActionProvider: true,
 		ExecuteCommandProvider: &lsp.ExecuteCommandOptions{
 			Commands: handlers.CommandKeys(),
 		},
+		Workspace: &lsp.WorkspaceServerCapabilities{
+			WorkspaceFolders: &lsp.WorkspaceFoldersServerCapabilities{
+				Supported:           true,
+				ChangeNotifications: true,
+			},
+		},
+	}
+
+	// A logger per service keeps each editor's mirrored log lines to itself
+	// when several are connected.
+	svc := lsp.NewServiceWithIO(capabilities, logger.Child(), Version, in, out)
+
+	if !strings.EqualFold(cfg.ClientLogLevel, "off") {
+		if level, err := lsp.ParseLogLevel(cfg.ClientLogLevel); err == nil {
+			svc.SetClientLogLevel(level)
+		}
 	}
 
-	svc := lsp.NewService(capabilities, logger, Version)
 	completionHandler := handlers.NewCompletionHandler(cfg, registry)
 	completionHandler.Register(svc)
 	actionHandler := handlers.NewActionHandler(cfg, registry)
 	actionHandler.Register(svc)
-	logger.Log("LSP service initialized, listening on stdin")
+	return svc
+}
 
-	if err := svc.Start(); err != nil {
-		logger.Log("LSP service error:", err.Error())
+func newLogger(cfg *config.Config) (*lsp.Logger, error) {
+	level, err := lsp.ParseLogLevel(cfg.LogLevel)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make([]*regexp.Regexp, 0, len(cfg.LogRedactPatterns))
+
+	for _, pattern := range cfg.LogRedactPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log redact pattern %q: %w", pattern, err)
+		}
+		patterns = append(patterns, re)
+	}
+
+	return lsp.NewLogger(lsp.LoggerOptions{
+		Path:           cfg.LogFile,
+		Level:          level,
+		JSON:           cfg.LogFormat == "json",
+		MaxSize:        int64(cfg.LogMaxSize) * 1024 * 1024,
+		MaxFiles:       cfg.LogMaxFiles,
+		Secrets:        []string{cfg.OpenAIKey, cfg.AnthropicKey},
+		RedactPatterns: patterns,
+	}), nil
+}
+
+func withTrace(provider providers.Provider, trace *lsp.Trace) providers.Provider {
+	if trace == nil {
+		return provider
+	}
+	return providers.NewTracingProvider(provider, trace)
+}
+
+func serve(cfg *config.Config, registry *providers.Registry, logger *lsp.Logger, trace *lsp.Trace) {
+	ln, err := lsp.Listen(cfg.Listen)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Listen error: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		logger.Log("shutting down listener")
+		ln.Close()
+	}()
+
+	logger.Log("LSP service listening on", cfg.Listen)
+
+	err = lsp.Serve(ln, logger, func(conn net.Conn) *lsp.Service {
+		svc := newService(cfg, registry, logger, conn, conn)
+		svc.SetTrace(trace)
+		return svc
+	})
+
+	if err != nil {
+		logger.Error("LSP service error:", err.Error())
 		os.Exit(1)
 	}
 }
@@ -112,7 +245,7 @@ func debugMode(cfg *config.Config, registry *providers.Registry, logger *lsp.Log
 	}, "debug.js", "javascript", cfg.NumSuggestions)
 
 	if err != nil {
-		logger.Log("Completion error:", err.Error())
+		logger.Error("Completion error:", err.Error())
 		fmt.Fprintf(os.Stderr, "Error: %s\n", err.Error())
 		os.Exit(1)
 	}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+)
+
+// Messages whose content depends on timing or local settings and are left
+// out of the diff.
+var replayIgnoredMethods = map[string]bool{
+	lsp.EventShowMessage: true,
+	lsp.EventProgress:    true,
+	lsp.EventLogMessage:  true,
+}
+
+const (
+	replayMaxGap     = time.Second
+	replaySettleTime = time.Second
+)
+
+// frameCollector parses the framed messages written by a service.
+type frameCollector struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	messages []json.RawMessage
+	last     time.Time
+}
+
+func (c *frameCollector) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf.Write(p)
+	c.last = time.Now()
+
+	for {
+		data := c.buf.Bytes()
+		headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+
+		if headerEnd == -1 {
+			break
+		}
+
+		length := 0
+
+		for _, line := range strings.Split(string(data[:headerEnd]), "\r\n") {
+			if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+				length, _ = strconv.Atoi(strings.TrimSpace(v))
+			}
+		}
+
+		if len(data) < headerEnd+4+length {
+			break
+		}
+
+		msg := make([]byte, length)
+		copy(msg, data[headerEnd+4:headerEnd+4+length])
+		c.messages = append(c.messages, msg)
+		c.buf.Next(headerEnd + 4 + length)
+	}
+
+	return len(p), nil
+}
+
+func (c *frameCollector) idleSince() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.last
+}
+
+func (c *frameCollector) collected() []json.RawMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]json.RawMessage(nil), c.messages...)
+}
+
+// replay feeds the client messages of a recorded trace into a fresh service
+// backed by the recorded provider results, then diffs what the service sends
+// against what was recorded. It returns the process exit code.
+func replay(cfg *config.Config) int {
+	entries, err := lsp.ReadTrace(cfg.ReplayFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %s\n", err.Error())
+		return 1
+	}
+
+	logger, err := newLogger(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		return 1
+	}
+
+	if err := cfg.LoadLanguages(); err != nil {
+		fmt.Fprintf(os.Stderr, "Configuration error: %s\n", err.Error())
+		return 1
+	}
+
+	defer logger.Close()
+	logger.Log("Replaying trace", cfg.ReplayFile, "entries:", len(entries))
+
+	stub, err := providers.NewReplayProvider(entries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %s\n", err.Error())
+		return 1
+	}
+
+	registry := providers.NewRegistry()
+	registry.Register("replay", stub)
+	registry.SetCurrent("replay")
+
+	in, feed := io.Pipe()
+	out := &frameCollector{}
+	svc := newService(cfg, registry, logger, in, out)
+	svc.SetExitHandler(func() {
+		feed.Close()
+	})
+
+	done := make(chan error, 1)
+	go func() {
+		done <- svc.Start()
+	}()
+
+	var expected []json.RawMessage
+	var prev time.Time
+
+	for _, entry := range entries {
+		switch entry.Direction {
+		case lsp.TraceOut:
+			expected = append(expected, entry.Message)
+		case lsp.TraceIn:
+			if !prev.IsZero() {
+				time.Sleep(min(entry.Time.Sub(prev), replayMaxGap))
+			}
+			prev = entry.Time
+
+			header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(entry.Message))
+			feed.Write(append([]byte(header), entry.Message...))
+		}
+	}
+
+	settle := max(replaySettleTime, 2*time.Duration(cfg.Debounce)*time.Millisecond)
+
+	for time.Since(out.idleSince()) < settle {
+		time.Sleep(settle / 10)
+	}
+
+	feed.Close()
+
+	if err := <-done; err != nil {
+		fmt.Fprintf(os.Stderr, "Replay error: %s\n", err.Error())
+		return 1
+	}
+
+	diffs := diffMessages(expected, out.collected())
+
+	if len(diffs) == 0 {
+		fmt.Printf("Replay matched: %d outgoing message(s)\n", len(expected))
+		return 0
+	}
+
+	for _, d := range diffs {
+		fmt.Println(d)
+	}
+
+	fmt.Printf("\nReplay differed: %d difference(s)\n", len(diffs))
+	return 1
+}
+
+// keyMessages indexes messages by response ID, or by method and occurrence
+// for requests and notifications, with each message in canonical JSON.
+func keyMessages(messages []json.RawMessage) (map[string]string, []string) {
+	keyed := make(map[string]string, len(messages))
+	order := make([]string, 0, len(messages))
+	counts := make(map[string]int)
+
+	for _, raw := range messages {
+		var msg struct {
+			ID     *lsp.ID `json:"id"`
+			Method string  `json:"method"`
+		}
+
+		var value any
+
+		if json.Unmarshal(raw, &msg) != nil || json.Unmarshal(raw, &value) != nil {
+			continue
+		}
+
+		if replayIgnoredMethods[msg.Method] {
+			continue
+		}
+
+		var key string
+
+		if msg.Method == "" && msg.ID != nil {
+			key = "response " + msg.ID.String()
+		} else {
+			counts[msg.Method]++
+			key = fmt.Sprintf("%s #%d", msg.Method, counts[msg.Method])
+		}
+
+		canonical, _ := json.Marshal(value)
+		keyed[key] = string(canonical)
+		order = append(order, key)
+	}
+
+	return keyed, order
+}
+
+func diffMessages(expected, actual []json.RawMessage) []string {
+	want, wantOrder := keyMessages(expected)
+	got, gotOrder := keyMessages(actual)
+	var diffs []string
+
+	for _, key := range wantOrder {
+		g, ok := got[key]
+
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("missing %s:\n  - %s", key, want[key]))
+		case g != want[key]:
+			diffs = append(diffs, fmt.Sprintf("changed %s:\n  - %s\n  + %s", key, want[key], g))
+		}
+	}
+
+	var extra []string
+
+	for _, key := range gotOrder {
+		if _, ok := want[key]; !ok {
+			extra = append(extra, fmt.Sprintf("unexpected %s:\n  + %s", key, got[key]))
+		}
+	}
+
+	sort.Strings(extra)
+	return append(diffs, extra...)
+}
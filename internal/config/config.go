@@ -20,13 +20,36 @@ type Config struct {
 	Debounce               int
 	TriggerCharacters      []string
 	NumSuggestions         int
+	CompletionConcurrency  int
+	CompletionSoftDeadline int
+	CompletionCacheSize    int
+	Snippets               bool
+	InvokedIsManual        bool
+	ManualNumSuggestions   int
+	ManualMaxTokens        int
+	CompleteInStrings      bool
+	CompleteInComments     bool
+	LanguageConfigFile     string
+	ContextTokenBudget     int
+	RelatedSnippetsBudget  int
+	DisabledProcessors     []string
+	Languages              map[string]LanguageSettings
 	LogFile                string
+	LogLevel               string
+	LogFormat              string
+	LogMaxSize             int
+	LogMaxFiles            int
+	LogRedactPatterns      []string
+	ClientLogLevel         string
 	FetchTimeout           int
 	ActionTimeout          int
 	CompletionTimeout      int
 	DebugQuery             string
 	EnableProgressSpinner  bool
 	ProgressUpdateInterval int
+	Listen                 string
+	RecordFile             string
+	ReplayFile             string
 }
 
 func DefaultConfig() *Config {
@@ -41,11 +64,22 @@ func DefaultConfig() *Config {
 		Debounce:               200,
 		TriggerCharacters:      []string{"{", "(", " "},
 		NumSuggestions:         1,
+		CompletionConcurrency:  4,
+		CompletionSoftDeadline: 3000,
+		CompletionCacheSize:    64,
+		ManualMaxTokens:        512,
+		ContextTokenBudget:     6000,
+		RelatedSnippetsBudget:  1000,
 		FetchTimeout:           15000,
 		ActionTimeout:          15000,
 		CompletionTimeout:      15000,
 		EnableProgressSpinner:  true,
 		ProgressUpdateInterval: 200,
+		LogLevel:               "info",
+		LogFormat:              "text",
+		LogMaxSize:             10,
+		LogMaxFiles:            3,
+		ClientLogLevel:         "warn",
 	}
 }
 
@@ -66,13 +100,35 @@ func Load() *Config {
 	debounce := flag.Int("debounce", getEnvOrDefaultInt("DEBOUNCE", cfg.Debounce), "Debounce delay (ms)")
 	triggerChars := flag.String("trigger-chars", getEnvOrDefault("TRIGGER_CHARACTERS", "{||(|| "), "Completion trigger characters (separated by ||)")
 	numSuggestions := flag.Int("num-suggestions", getEnvOrDefaultInt("NUM_SUGGESTIONS", cfg.NumSuggestions), "Number of suggestions")
+	completionConcurrency := flag.Int("completion-concurrency", getEnvOrDefaultInt("COMPLETION_CONCURRENCY", cfg.CompletionConcurrency), "Maximum suggestions requested at once for a completion (0 requests all at once)")
+	completionSoftDeadline := flag.Int("completion-soft-deadline", getEnvOrDefaultInt("COMPLETION_SOFT_DEADLINE", cfg.CompletionSoftDeadline), "Return the suggestions received so far after this long (ms, 0 waits for all)")
+	completionCacheSize := flag.Int("completion-cache-size", getEnvOrDefaultInt("COMPLETION_CACHE_SIZE", cfg.CompletionCacheSize), "Number of completion results cached for reuse while typing (0 disables)")
+	snippets := flag.Bool("snippets", getEnvOrDefaultBool("SNIPPETS", cfg.Snippets), "Return completions as snippets with placeholders when the editor supports them")
+	invokedIsManual := flag.Bool("invoked-is-manual", getEnvOrDefaultBool("INVOKED_IS_MANUAL", cfg.InvokedIsManual), "Treat completions the editor reports as invoked as manual requests (only for editors that do not also report completion while typing as invoked)")
+	manualNumSuggestions := flag.Int("manual-num-suggestions", getEnvOrDefaultInt("MANUAL_NUM_SUGGESTIONS", cfg.ManualNumSuggestions), "Number of suggestions for manually invoked completions (0 uses num-suggestions)")
+	manualMaxTokens := flag.Int("manual-max-tokens", getEnvOrDefaultInt("MANUAL_MAX_TOKENS", cfg.ManualMaxTokens), "Maximum output tokens for manually invoked completions (0 uses the provider default)")
+	completeInStrings := flag.Bool("complete-in-strings", getEnvOrDefaultBool("COMPLETE_IN_STRINGS", cfg.CompleteInStrings), "Trigger completions automatically inside string literals")
+	completeInComments := flag.Bool("complete-in-comments", getEnvOrDefaultBool("COMPLETE_IN_COMMENTS", cfg.CompleteInComments), "Trigger completions automatically inside comments")
+	contextTokenBudget := flag.Int("context-token-budget", getEnvOrDefaultInt("CONTEXT_TOKEN_BUDGET", cfg.ContextTokenBudget), "Approximate number of tokens of the current file sent with a completion (0 sends the whole file)")
+	relatedSnippetsBudget := flag.Int("related-snippets-budget", getEnvOrDefaultInt("RELATED_SNIPPETS_BUDGET", cfg.RelatedSnippetsBudget), "Approximate tokens of similar code from other open files sent with a completion (0 disables)")
+	disabledProcessors := flag.String("disable-processors", getEnvOrDefault("DISABLE_PROCESSORS", ""), "Completion post-processors to switch off: fences, trim, prefix, suffix, brackets, indent, empty (separated by ||)")
+	languageConfig := flag.String("language-config", getEnvOrDefault("LANGUAGE_CONFIG", ""), "JSON file with per-language completion settings")
 	logFile := flag.String("log-file", getEnvOrDefault("LOG_FILE", "~/.cache/helix-assist.log"), "Log file path")
+	logLevel := flag.String("log-level", getEnvOrDefault("LOG_LEVEL", cfg.LogLevel), "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", getEnvOrDefault("LOG_FORMAT", cfg.LogFormat), "Log format: text or json")
+	logMaxSize := flag.Int("log-max-size", getEnvOrDefaultInt("LOG_MAX_SIZE", cfg.LogMaxSize), "Rotate the log file at this size (MB, 0 disables rotation)")
+	logMaxFiles := flag.Int("log-max-files", getEnvOrDefaultInt("LOG_MAX_FILES", cfg.LogMaxFiles), "Number of rotated log files to keep")
+	logRedactPatterns := flag.String("log-redact-patterns", getEnvOrDefault("LOG_REDACT_PATTERNS", ""), "Regular expressions to redact from logs (separated by ||)")
+	clientLogLevel := flag.String("client-log-level", getEnvOrDefault("CLIENT_LOG_LEVEL", cfg.ClientLogLevel), "Minimum level mirrored to the editor via window/logMessage: debug, info, warn, error or off")
 	fetchTimeout := flag.Int("fetch-timeout", getEnvOrDefaultInt("FETCH_TIMEOUT", cfg.FetchTimeout), "Fetch timeout (ms)")
 	actionTimeout := flag.Int("action-timeout", getEnvOrDefaultInt("ACTION_TIMEOUT", cfg.ActionTimeout), "Action timeout (ms)")
 	completionTimeout := flag.Int("completion-timeout", getEnvOrDefaultInt("COMPLETION_TIMEOUT", cfg.CompletionTimeout), "Completion timeout (ms)")
 	debugQuery := flag.String("debug-query", "", "Debug mode: test provider with a query and exit")
 	enableProgressSpinner := flag.Bool("enable-progress-spinner", getEnvOrDefaultBool("ENABLE_PROGRESS_SPINNER", cfg.EnableProgressSpinner), "Enable animated progress spinner")
 	progressUpdateInterval := flag.Int("progress-update-interval", getEnvOrDefaultInt("PROGRESS_UPDATE_INTERVAL", cfg.ProgressUpdateInterval), "Progress update interval (ms)")
+	recordFile := flag.String("record", getEnvOrDefault("RECORD_FILE", ""), "Record the LSP session and provider results to a JSONL trace")
+	replayFile := flag.String("replay", "", "Replay a recorded trace against a stub provider and diff the output, then exit")
+	listen := flag.String("listen", getEnvOrDefault("LISTEN", ""), "Accept LSP connections on tcp://host:port or unix:///path instead of stdio")
 
 	flag.Parse()
 
@@ -88,13 +144,41 @@ func Load() *Config {
 	cfg.Debounce = *debounce
 	cfg.TriggerCharacters = strings.Split(*triggerChars, "||")
 	cfg.NumSuggestions = *numSuggestions
+	cfg.CompletionConcurrency = *completionConcurrency
+	cfg.CompletionSoftDeadline = *completionSoftDeadline
+	cfg.CompletionCacheSize = *completionCacheSize
+	cfg.Snippets = *snippets
+	cfg.InvokedIsManual = *invokedIsManual
+	cfg.ManualNumSuggestions = *manualNumSuggestions
+	cfg.ManualMaxTokens = *manualMaxTokens
+	cfg.CompleteInStrings = *completeInStrings
+	cfg.CompleteInComments = *completeInComments
+	cfg.LanguageConfigFile = *languageConfig
+	cfg.ContextTokenBudget = *contextTokenBudget
+	cfg.RelatedSnippetsBudget = *relatedSnippetsBudget
+
+	if *disabledProcessors != "" {
+		cfg.DisabledProcessors = strings.Split(*disabledProcessors, "||")
+	}
 	cfg.LogFile = *logFile
+	cfg.LogLevel = *logLevel
+	cfg.LogFormat = *logFormat
+	cfg.LogMaxSize = *logMaxSize
+	cfg.LogMaxFiles = *logMaxFiles
+
+	if *logRedactPatterns != "" {
+		cfg.LogRedactPatterns = strings.Split(*logRedactPatterns, "||")
+	}
+	cfg.ClientLogLevel = *clientLogLevel
 	cfg.FetchTimeout = *fetchTimeout
 	cfg.ActionTimeout = *actionTimeout
 	cfg.CompletionTimeout = *completionTimeout
 	cfg.DebugQuery = *debugQuery
 	cfg.EnableProgressSpinner = *enableProgressSpinner
 	cfg.ProgressUpdateInterval = *progressUpdateInterval
+	cfg.Listen = *listen
+	cfg.RecordFile = *recordFile
+	cfg.ReplayFile = *replayFile
 
 	return cfg
 }
@@ -112,6 +196,28 @@ func (c *Config) Validate() error {
 		return &ConfigError{Message: "Anthropic API key is required when using anthropic handler"}
 	}
 
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		return &ConfigError{Message: "log level must be 'debug', 'info', 'warn' or 'error'"}
+	}
+
+	switch strings.ToLower(c.ClientLogLevel) {
+	case "debug", "info", "warn", "warning", "error", "off":
+	default:
+		return &ConfigError{Message: "client log level must be 'debug', 'info', 'warn', 'error' or 'off'"}
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		return &ConfigError{Message: "log format must be 'text' or 'json'"}
+	}
+
+	// Sessions from several connections would interleave in one trace, which
+	// then cannot be replayed.
+	if c.RecordFile != "" && c.Listen != "" {
+		return &ConfigError{Message: "record cannot be used with listen"}
+	}
+
 	return nil
 }
 
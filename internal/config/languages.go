@@ -0,0 +1,113 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// LanguageSettings overrides the completion settings for one language ID.
+// Unset fields fall back to the global configuration.
+type LanguageSettings struct {
+	Enabled           *bool    `json:"enabled,omitempty"`
+	TriggerCharacters []string `json:"triggerCharacters,omitempty"`
+	Debounce          *int     `json:"debounce,omitempty"`
+	NumSuggestions    *int     `json:"numSuggestions,omitempty"`
+	Model             string   `json:"model,omitempty"`
+}
+
+// LanguageConfig is the completion configuration resolved for a language.
+type LanguageConfig struct {
+	Enabled           bool
+	TriggerCharacters []string
+	Debounce          int
+	NumSuggestions    int
+	// Model is empty when the provider's completion model should be used.
+	Model string
+}
+
+// LoadLanguages reads the per-language settings from LanguageConfigFile, a
+// JSON object keyed by language ID.
+func (c *Config) LoadLanguages() error {
+	if c.LanguageConfigFile == "" {
+		return nil
+	}
+
+	path := c.LanguageConfigFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return &ConfigError{Message: fmt.Sprintf("cannot read language config: %s", err.Error())}
+	}
+
+	var languages map[string]LanguageSettings
+
+	if err := json.Unmarshal(data, &languages); err != nil {
+		return &ConfigError{Message: fmt.Sprintf("invalid language config %s: %s", path, err.Error())}
+	}
+
+	for id, settings := range languages {
+		if settings.Debounce != nil && *settings.Debounce < 0 {
+			return &ConfigError{Message: fmt.Sprintf("language config for %s: debounce must not be negative", id)}
+		}
+
+		if settings.NumSuggestions != nil && *settings.NumSuggestions < 1 {
+			return &ConfigError{Message: fmt.Sprintf("language config for %s: numSuggestions must be at least 1", id)}
+		}
+	}
+
+	c.Languages = languages
+	return nil
+}
+
+// Language resolves the completion configuration for a language ID.
+func (c *Config) Language(languageID string) LanguageConfig {
+	lang := LanguageConfig{
+		Enabled:           true,
+		TriggerCharacters: c.TriggerCharacters,
+		Debounce:          c.Debounce,
+		NumSuggestions:    c.NumSuggestions,
+	}
+
+	settings, ok := c.Languages[languageID]
+	if !ok {
+		return lang
+	}
+
+	if settings.Enabled != nil {
+		lang.Enabled = *settings.Enabled
+	}
+
+	if settings.TriggerCharacters != nil {
+		lang.TriggerCharacters = settings.TriggerCharacters
+	}
+
+	if settings.Debounce != nil {
+		lang.Debounce = *settings.Debounce
+	}
+
+	if settings.NumSuggestions != nil {
+		lang.NumSuggestions = *settings.NumSuggestions
+	}
+
+	lang.Model = settings.Model
+	return lang
+}
+
+// AllTriggerCharacters returns the global trigger characters together with
+// those of every configured language, as the server has to advertise them
+// all up front.
+func (c *Config) AllTriggerCharacters() []string {
+	chars := slices.Clone(c.TriggerCharacters)
+
+	for _, settings := range c.Languages {
+		for _, ch := range settings.TriggerCharacters {
+			if !slices.Contains(chars, ch) {
+				chars = append(chars, ch)
+			}
+		}
+	}
+
+	slices.Sort(chars[len(c.TriggerCharacters):])
+	return chars
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strings"
 	"time"
 
@@ -50,7 +51,8 @@ func (h *ActionHandler) Register(svc *lsp.Service) {
 		var params lsp.CodeActionParams
 
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("codeAction parse error:", err.Error())
+			svc.Logger.Error("codeAction parse error:", err.Error())
+			svc.SendError(msg.ID, lsp.ErrorInvalidParams, "invalid codeAction params: "+err.Error())
 			return
 		}
 
@@ -96,33 +98,38 @@ func (h *ActionHandler) Register(svc *lsp.Service) {
 func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
 	defer func() {
 		if r := recover(); r != nil {
-			svc.Logger.Log("executeCommand panic:", r)
+			svc.Logger.Error("executeCommand panic:", r)
+			svc.SendError(msg.ID, lsp.ErrorInternalError, fmt.Sprintf("internal error: %v", r))
 		}
 	}()
 
 	var params lsp.ExecuteCommandParams
 
 	if err := json.Unmarshal(msg.Params, &params); err != nil {
-		svc.Logger.Log("executeCommand parse error:", err.Error())
+		svc.Logger.Error("executeCommand parse error:", err.Error())
+		svc.SendError(msg.ID, lsp.ErrorInvalidParams, "invalid executeCommand params: "+err.Error())
 		return
 	}
 
 	if len(params.Arguments) == 0 {
-		svc.Logger.Log("executeCommand: no arguments")
+		svc.Logger.Warn("executeCommand: no arguments")
+		svc.SendError(msg.ID, lsp.ErrorInvalidParams, "executeCommand requires an argument")
 		return
 	}
 
 	argBytes, err := json.Marshal(params.Arguments[0])
 
 	if err != nil {
-		svc.Logger.Log("executeCommand: marshal arg error:", err.Error())
+		svc.Logger.Error("executeCommand: marshal arg error:", err.Error())
+		svc.SendError(msg.ID, lsp.ErrorInvalidParams, "invalid executeCommand argument: "+err.Error())
 		return
 	}
 
 	var cmdArg lsp.CommandArgument
 
 	if err := json.Unmarshal(argBytes, &cmdArg); err != nil {
-		svc.Logger.Log("executeCommand: parse arg error:", err.Error())
+		svc.Logger.Error("executeCommand: parse arg error:", err.Error())
+		svc.SendError(msg.ID, lsp.ErrorInvalidParams, "invalid executeCommand argument: "+err.Error())
 		return
 	}
 
@@ -137,17 +144,24 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 		}
 	}
 
+	if !svc.Client.SupportsApplyEdit() {
+		svc.Logger.Warn("executeCommand: client does not support workspace/applyEdit")
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, "client does not support workspace/applyEdit")
+		return
+	}
+
 	currentURI := svc.Buffers.CurrentURI()
 
 	if currentURI == "" {
-		svc.Logger.Log("executeCommand: no current URI")
+		svc.Logger.Warn("executeCommand: no current URI")
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, "no active document")
 		return
 	}
 
 	var progress *util.ProgressIndicator
 
 	if h.cfg.EnableProgressSpinner {
-		progress = util.NewProgressIndicator(svc, h.cfg)
+		progress = util.NewProgressIndicator(svc, h.cfg, "Executing "+params.Command, h.registry.CurrentName())
 		progress.Start()
 		defer progress.Stop()
 	} else {
@@ -159,24 +173,31 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 
 	buffer, ok := svc.Buffers.Get(currentURI)
 	if !ok {
-		svc.Logger.Log("executeCommand: buffer not found")
+		svc.Logger.Warn("executeCommand: buffer not found")
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, "document not found: "+currentURI)
 		return
 	}
 
-	svc.Logger.Log("chat request content:", content)
-	svc.Logger.Log("chat request query:", query)
+	svc.Logger.Debug("chat request content:", content)
+	svc.Logger.Debug("chat request query:", query)
 
 	if len(cmdArg.Diagnostics) > 0 {
 		query += "\n\nDiagnostics: " + strings.Join(cmdArg.Diagnostics, "\n- ")
-		svc.Logger.Log("chat request with diagnostics:", query)
+		svc.Logger.Debug("chat request with diagnostics:", query)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
+	reqCtx := svc.Context(msg)
+	ctx, cancel := context.WithTimeout(reqCtx, time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
 	defer cancel()
 
 	resp, err := h.registry.Chat(ctx, query, content, currentURI, buffer.LanguageID)
 	if err != nil {
-		svc.Logger.Log("chat failed:", err.Error())
+		if reqCtx.Err() != nil {
+			svc.Logger.Log("chat cancelled:", err.Error())
+			return
+		}
+
+		svc.Logger.Error("chat failed:", err.Error())
 		svc.SendDiagnostics([]lsp.Diagnostic{
 			{
 				Message:  err.Error(),
@@ -184,14 +205,15 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 				Range:    cmdArg.Range,
 			},
 		}, 0)
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, err.Error())
 		return
 	}
 
 	svc.Logger.Log("chat response received, result length:", len(resp.Result))
-	svc.Logger.Log("chat response result:", resp.Result)
+	svc.Logger.Debug("chat response result:", resp.Result)
 
 	if resp.Result == "" {
-		svc.Logger.Log("chat: no completion found")
+		svc.Logger.Warn("chat: no completion found")
 		svc.SendDiagnostics([]lsp.Diagnostic{
 			{
 				Message:  "No completion found",
@@ -199,35 +221,53 @@ func (h *ActionHandler) executeCommand(svc *lsp.Service, msg *lsp.JSONRPCMessage
 				Range:    cmdArg.Range,
 			},
 		}, 0)
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, "no completion found")
 		return
 	}
 
 	result := util.PadContent(strings.TrimSpace(resp.Result), padding) + "\n"
-	svc.Logger.Log("received chat result:", result)
+	svc.Logger.Debug("received chat result:", result)
 
-	svc.Send(&lsp.JSONRPCMessage{
-		Method: lsp.EventApplyEdit,
-		ID:     msg.ID,
-		Params: mustMarshal(lsp.ApplyWorkspaceEditParams{
-			Label: params.Command,
-			Edit: lsp.WorkspaceEdit{
-				Changes: map[string][]lsp.TextEdit{
-					currentURI: {
-						{
-							Range:   cmdArg.Range,
-							NewText: result,
-						},
+	var applied lsp.ApplyWorkspaceEditResult
+
+	editCtx, editCancel := context.WithTimeout(reqCtx, time.Duration(h.cfg.ActionTimeout)*time.Millisecond)
+	defer editCancel()
+
+	err = svc.Request(editCtx, lsp.EventApplyEdit, lsp.ApplyWorkspaceEditParams{
+		Label: params.Command,
+		Edit: lsp.WorkspaceEdit{
+			Changes: map[string][]lsp.TextEdit{
+				currentURI: {
+					{
+						Range:   cmdArg.Range,
+						NewText: result,
 					},
 				},
 			},
-		}),
-	})
-}
+		},
+	}, &applied)
 
-func mustMarshal(v any) json.RawMessage {
-	data, err := json.Marshal(v)
 	if err != nil {
-		panic(err)
+		svc.Logger.Error("applyEdit failed:", err.Error())
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, "applyEdit failed: "+err.Error())
+		return
+	}
+
+	if !applied.Applied {
+		reason := applied.FailureReason
+
+		if reason == "" {
+			reason = "edit was rejected by the editor"
+		}
+
+		svc.Logger.Warn("applyEdit not applied:", reason)
+		svc.SendShowMessage(lsp.MessageTypeWarning, params.Command+" could not be applied: "+reason)
+		svc.SendError(msg.ID, lsp.ErrorRequestFailed, reason)
+		return
 	}
-	return data
+
+	svc.Send(&lsp.JSONRPCMessage{
+		ID:     msg.ID,
+		Result: nil,
+	})
 }
@@ -3,7 +3,9 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/leona/helix-assist/internal/config"
@@ -16,13 +18,54 @@ type CompletionHandler struct {
 	cfg       *config.Config
 	registry  *providers.Registry
 	debouncer *util.Debouncer
+	pendingMu sync.Mutex
+	pending   map[string]pendingCompletion
+	cache     *util.LRU[completionCacheKey, completionCacheEntry]
+	pipeline  util.Pipeline
 }
 
+// pendingCompletion is the latest completion request for a document that has
+// not been answered yet.
+type pendingCompletion struct {
+	id  lsp.ID
+	seq uint64
+	ctx context.Context
+}
+
+// completionCacheKey is where a completion was requested: the document, the
+// line and the text of the line before the cursor.
+type completionCacheKey struct {
+	uri    string
+	line   int
+	prefix string
+}
+
+// completionCacheEntry holds the cleaned suggestions returned for a cursor
+// position, along with the text around it at the time.
+type completionCacheEntry struct {
+	before string
+	after  string
+	hints  []string
+}
+
+// completionFormat is what the client accepts in completion items.
+type completionFormat struct {
+	insertReplace bool
+	snippets      bool
+}
+
+// NewCompletionHandler expects unknown post-processor names in cfg to have
+// been rejected already; they are otherwise ignored.
 func NewCompletionHandler(cfg *config.Config, registry *providers.Registry) *CompletionHandler {
+	pipeline, _ := util.NewPipeline(cfg.DisabledProcessors)
+
 	return &CompletionHandler{
 		cfg:       cfg,
 		registry:  registry,
 		debouncer: util.NewDebouncer(),
+		pending:   make(map[string]pendingCompletion),
+		cache:     util.NewLRU[completionCacheKey, completionCacheEntry](cfg.CompletionCacheSize),
+		pipeline:  pipeline,
 	}
 }
 
@@ -30,83 +73,271 @@ func (h *CompletionHandler) Register(svc *lsp.Service) {
 	svc.On(lsp.EventCompletion, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
 		var params lsp.CompletionParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("completion parse error:", err.Error())
+			svc.Logger.Error("completion parse error:", err.Error())
+			svc.SendError(msg.ID, lsp.ErrorInvalidParams, "invalid completion params: "+err.Error())
+			return
+		}
+
+		if msg.ID == nil {
+			return
+		}
+
+		uri := params.TextDocument.URI
+		reqCtx := svc.Context(msg)
+		if !h.supersede(svc, uri, msg, reqCtx) {
 			return
 		}
 
-		buffer, ok := svc.Buffers.Get(params.TextDocument.URI)
+		buffer, ok := svc.Buffers.Get(uri)
 		if !ok {
-			h.sendEmptyCompletion(svc, msg.ID)
+			h.reply(svc, uri, *msg.ID, nil)
+			return
+		}
+
+		lang := h.cfg.Language(buffer.LanguageID)
+
+		if !lang.Enabled {
+			h.reply(svc, uri, *msg.ID, nil)
 			return
 		}
 
 		lastContentVersion := buffer.Version
-		content := util.GetContent(buffer.Text, params.Position.Line, params.Position.Character)
+		encoding := svc.Buffers.PositionEncoding()
+		column := encoding.ByteColumn(buffer.Text, params.Position)
+		content := util.GetContent(buffer.Text, params.Position.Line, column)
+
+		// A manual invocation asks for a fresh completion right away.
+		if h.manual(params) {
+			h.debouncer.Cancel(uri)
+			h.doCompletion(reqCtx, svc, msg, params, lastContentVersion, content)
+			return
+		}
+
+		if items, ok := h.cachedCompletion(uri, params.Position, content, encoding, h.format(svc)); ok {
+			svc.Logger.Log("completion cache hit:", len(items))
+			h.debouncer.Cancel(uri)
+			h.reply(svc, uri, *msg.ID, items)
+			return
+		}
 
 		// Skip if last character is a dot (likely method/property access)
 		if content.LastCharacter == "." {
-			h.sendEmptyCompletion(svc, msg.ID)
+			h.reply(svc, uri, *msg.ID, nil)
+			return
+		}
+
+		if reason := h.skipAutomatic(params, content, buffer.LanguageID, lang); reason != "" {
+			svc.Logger.Debug("skipping automatic completion -", reason)
+			h.reply(svc, uri, *msg.ID, nil)
 			return
 		}
 
-		h.debouncer.Debounce("completion", func() {
-			h.doCompletion(svc, msg, params, lastContentVersion, content)
-		}, time.Duration(h.cfg.Debounce)*time.Millisecond)
+		h.debouncer.Debounce(uri, func() {
+			h.doCompletion(reqCtx, svc, msg, params, lastContentVersion, content)
+		}, time.Duration(lang.Debounce)*time.Millisecond)
+	})
+
+	// Suggestions for a closed document can no longer be typed through.
+	svc.On(lsp.EventDidClose, func(svc *lsp.Service, msg *lsp.JSONRPCMessage) {
+		var params lsp.DidCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return
+		}
+
+		h.cache.RemoveFunc(func(key completionCacheKey) bool {
+			return key.uri == params.TextDocument.URI
+		})
 	})
 }
 
-func (h *CompletionHandler) doCompletion(svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams, lastContentVersion int, content util.ContentParts) {
+// manual reports whether the user explicitly asked for completions. Clients
+// also report completion while typing as invoked, so this is only trusted
+// when configured.
+func (h *CompletionHandler) manual(params lsp.CompletionParams) bool {
+	return h.cfg.InvokedIsManual && params.Invoked()
+}
+
+// skipAutomatic returns why a completion triggered while typing should not
+// run at the cursor, or "" if it should. Only a whitespace trigger character
+// is skipped inside strings and comments, where a space is usually prose;
+// completion requested any other way is left to the debounce.
+func (h *CompletionHandler) skipAutomatic(params lsp.CompletionParams, content util.ContentParts, languageID string, lang config.LanguageConfig) string {
+	ctx := params.Context
+
+	if ctx == nil || ctx.TriggerKind != lsp.CompletionTriggerCharacter {
+		return ""
+	}
+
+	// Trigger characters are advertised for all languages together.
+	if !slices.Contains(lang.TriggerCharacters, ctx.TriggerCharacter) {
+		return "not a trigger character for " + languageID
+	}
+
+	if strings.TrimSpace(ctx.TriggerCharacter) != "" {
+		return ""
+	}
+
+	inString, inComment := util.ScanLine(content.LastLine, languageID)
+
+	if inString && !h.cfg.CompleteInStrings {
+		return "inside a string"
+	}
+
+	if inComment && !h.cfg.CompleteInComments {
+		return "inside a comment"
+	}
+	return ""
+}
+
+// supersede makes msg the pending request for uri and answers the request it
+// replaces with an empty list, which also cancels any provider call still
+// running for it. It reports false if a request received after msg is
+// already pending, in which case msg itself is answered.
+func (h *CompletionHandler) supersede(svc *lsp.Service, uri string, msg *lsp.JSONRPCMessage, ctx context.Context) bool {
+	h.pendingMu.Lock()
+	prev, ok := h.pending[uri]
+	stale := ok && prev.seq > msg.Seq()
+
+	if !stale {
+		h.pending[uri] = pendingCompletion{id: *msg.ID, seq: msg.Seq(), ctx: ctx}
+	}
+	h.pendingMu.Unlock()
+
+	if stale {
+		svc.Logger.Log("completion superseded:", *msg.ID)
+		h.sendEmptyCompletion(svc, msg.ID)
+		return false
+	}
+
+	// A cancelled context means the client cancelled it or it was answered.
+	if ok && prev.ctx.Err() == nil {
+		svc.Logger.Log("completion superseded:", prev.id)
+		h.sendEmptyCompletion(svc, &prev.id)
+	}
+	return true
+}
+
+// release removes id as the pending request for uri. It reports false if id
+// was superseded in the meantime and has already been answered.
+func (h *CompletionHandler) release(uri string, id lsp.ID) bool {
+	h.pendingMu.Lock()
+	defer h.pendingMu.Unlock()
+
+	if prev, ok := h.pending[uri]; !ok || prev.id != id {
+		return false
+	}
+
+	delete(h.pending, uri)
+	return true
+}
+
+// reply answers id with items unless it was superseded.
+func (h *CompletionHandler) reply(svc *lsp.Service, uri string, id lsp.ID, items []lsp.CompletionItem) {
+	if !h.release(uri, id) {
+		return
+	}
+
+	if items == nil {
+		items = []lsp.CompletionItem{}
+	}
+
+	svc.Send(&lsp.JSONRPCMessage{
+		ID: &id,
+		Result: lsp.CompletionList{
+			IsIncomplete: false,
+			Items:        items,
+		},
+	})
+}
+
+func (h *CompletionHandler) doCompletion(reqCtx context.Context, svc *lsp.Service, msg *lsp.JSONRPCMessage, params lsp.CompletionParams, lastContentVersion int, content util.ContentParts) {
+	uri := params.TextDocument.URI
+
 	defer func() {
 		if r := recover(); r != nil {
-			svc.Logger.Log("completion panic:", r)
-			h.sendEmptyCompletion(svc, msg.ID)
+			svc.Logger.Error("completion panic:", r)
+			h.reply(svc, uri, *msg.ID, nil)
 		}
 	}()
 
-	buffer, ok := svc.Buffers.Get(params.TextDocument.URI)
+	if reqCtx.Err() != nil {
+		svc.Logger.Log("skipping completion - request cancelled")
+		h.release(uri, *msg.ID)
+		return
+	}
+
+	buffer, ok := svc.Buffers.Get(uri)
 	if !ok {
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.reply(svc, uri, *msg.ID, nil)
 		return
 	}
 
 	if buffer.Version > lastContentVersion {
 		svc.Logger.Log("skipping completion - content is stale")
-		h.sendEmptyCompletion(svc, msg.ID)
+		h.reply(svc, uri, *msg.ID, nil)
 		return
 	}
 
-	content = util.GetContent(buffer.Text, params.Position.Line, params.Position.Character)
+	encoding := svc.Buffers.PositionEncoding()
+	column := encoding.ByteColumn(buffer.Text, params.Position)
+	content = util.GetContent(buffer.Text, params.Position.Line, column)
 	svc.Logger.Log("calling completion", "language:", buffer.LanguageID)
 
 	var progress *util.ProgressIndicator
 
 	if h.cfg.EnableProgressSpinner {
-		progress = util.NewProgressIndicator(svc, h.cfg)
+		progress = util.NewProgressIndicator(svc, h.cfg, "Fetching completion", h.registry.CurrentName())
 		progress.Start()
 		defer progress.Stop()
 	} else {
 		svc.SendShowMessage(lsp.MessageTypeInfo, "Fetching completion...")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(h.cfg.CompletionTimeout)*time.Millisecond)
+	ctx, cancel := context.WithTimeout(reqCtx, time.Duration(h.cfg.CompletionTimeout)*time.Millisecond)
 	defer cancel()
-	contentAfter := content.ContentImmediatelyAfter
+	contentAfter := joinContentAfter(content)
+
+	format := h.format(svc)
+	lang := h.cfg.Language(buffer.LanguageID)
+	numSuggestions := lang.NumSuggestions
+	maxTokens := 0
 
-	if content.ContentAfter != "" {
-		if contentAfter != "" {
-			contentAfter += "\n" + content.ContentAfter
-		} else {
-			contentAfter = content.ContentAfter
+	if h.manual(params) {
+		maxTokens = h.cfg.ManualMaxTokens
+
+		if h.cfg.ManualNumSuggestions > 0 {
+			numSuggestions = h.cfg.ManualNumSuggestions
 		}
 	}
 
+	window := util.BuildContextWindow(content.ContentBefore, contentAfter, h.cfg.ContextTokenBudget)
+
+	if window.OmittedBefore > 0 || window.OmittedAfter > 0 {
+		svc.Logger.Debug("context window omitted lines before:", window.OmittedBefore, "after:", window.OmittedAfter)
+	}
+
 	hints, err := h.registry.Completion(ctx, providers.CompletionRequest{
-		ContentBefore: content.ContentBefore,
-		ContentAfter:  contentAfter,
-	}, params.TextDocument.URI, buffer.LanguageID, h.cfg.NumSuggestions)
+		ContentBefore:   window.Before,
+		ContentAfter:    window.After,
+		Header:          window.Header,
+		OmittedBefore:   window.OmittedBefore,
+		OmittedAfter:    window.OmittedAfter,
+		RelatedSnippets: h.relatedSnippets(svc, buffer, content),
+		Placeholders:    format.snippets,
+		MaxTokens:       maxTokens,
+		Model:           lang.Model,
+		Concurrency:     h.cfg.CompletionConcurrency,
+		SoftDeadline:    time.Duration(h.cfg.CompletionSoftDeadline) * time.Millisecond,
+	}, uri, buffer.LanguageID, numSuggestions)
 
 	if err != nil {
-		svc.Logger.Log("completion error:", err.Error())
+		if reqCtx.Err() != nil {
+			svc.Logger.Log("completion cancelled:", err.Error())
+			h.release(uri, *msg.ID)
+			return
+		}
+
+		svc.Logger.Error("completion error:", err.Error())
 		svc.SendDiagnostics([]lsp.Diagnostic{
 			{
 				Message:  err.Error(),
@@ -117,24 +348,133 @@ func (h *CompletionHandler) doCompletion(svc *lsp.Service, msg *lsp.JSONRPCMessa
 				},
 			},
 		}, 0)
+		h.reply(svc, uri, *msg.ID, nil)
 		return
 	}
 
 	svc.Logger.Log("completion hints:", len(hints))
 
-	items := make([]lsp.CompletionItem, 0, len(hints))
+	cleaned := make([]string, 0, len(hints))
+
 	for _, hint := range hints {
-		item := h.buildCompletionItem(hint, content, params.Position)
-		items = append(items, item)
+		if hint, ok := h.pipeline.Run(hint, content); ok {
+			cleaned = append(cleaned, hint)
+		}
 	}
 
-	svc.Send(&lsp.JSONRPCMessage{
-		ID: msg.ID,
-		Result: lsp.CompletionList{
-			IsIncomplete: false,
-			Items:        items,
-		},
+	cleaned = util.UniqueStrings(cleaned)
+	items := make([]lsp.CompletionItem, 0, len(cleaned))
+
+	for _, hint := range cleaned {
+		items = append(items, h.buildCompletionItem(hint, content, params.Position, encoding, format))
+	}
+
+	h.cache.Add(completionCacheKey{uri: uri, line: params.Position.Line, prefix: content.LastLine}, completionCacheEntry{
+		before: content.ContentBefore,
+		after:  contentAfter,
+		hints:  cleaned,
 	})
+
+	h.reply(svc, uri, *msg.ID, items)
+}
+
+func (h *CompletionHandler) format(svc *lsp.Service) completionFormat {
+	return completionFormat{
+		insertReplace: svc.Client.SupportsInsertReplace(),
+		snippets:      h.cfg.Snippets && svc.Client.SupportsSnippets(),
+	}
+}
+
+// Lines per window compared when looking for related code in other files,
+// and lines around the cursor they are compared against.
+const (
+	relatedWindowLines = 20
+	relatedQueryLines  = 15
+)
+
+// relatedSnippets picks the code in other open buffers most similar to the
+// lines around the cursor. Only files in the same language are searched, so
+// open configuration files holding credentials, such as .env files, are not
+// sent along with source code.
+func (h *CompletionHandler) relatedSnippets(svc *lsp.Service, current *lsp.Buffer, content util.ContentParts) []providers.RelatedSnippet {
+	if h.cfg.RelatedSnippetsBudget <= 0 || current.LanguageID == "" {
+		return nil
+	}
+
+	var sources []util.SnippetSource
+
+	for _, buf := range svc.Buffers.All() {
+		// Snippets are labelled with their path, which only file URIs have.
+		if buf.URI == current.URI || buf.LanguageID != current.LanguageID || lsp.URIToPath(buf.URI) == "" {
+			continue
+		}
+		sources = append(sources, util.SnippetSource{URI: buf.URI, Text: buf.Text})
+	}
+
+	if len(sources) == 0 {
+		return nil
+	}
+
+	beforeLines := strings.Split(content.ContentBefore, "\n")
+	query := strings.Join(beforeLines[max(len(beforeLines)-relatedQueryLines, 0):], "\n") + content.ContentImmediatelyAfter
+	found := util.FindSimilarSnippets(query, sources, relatedWindowLines, h.cfg.RelatedSnippetsBudget)
+	snippets := make([]providers.RelatedSnippet, 0, len(found))
+
+	for _, s := range found {
+		snippets = append(snippets, providers.RelatedSnippet{FilePath: lsp.URIToPath(s.URI), Text: s.Text})
+	}
+
+	if len(snippets) > 0 {
+		svc.Logger.Debug("related snippets:", len(snippets))
+	}
+	return snippets
+}
+
+// cachedCompletion reuses the suggestions cached for the longest start of
+// the cursor line when the text typed since that request is a prefix of them,
+// offering only the part that has not been typed yet.
+func (h *CompletionHandler) cachedCompletion(uri string, position lsp.Position, content util.ContentParts, encoding lsp.PositionEncoding, format completionFormat) ([]lsp.CompletionItem, bool) {
+	var entry completionCacheEntry
+	ok := false
+
+	for n := len(content.LastLine); n >= 0 && !ok; n-- {
+		entry, ok = h.cache.Get(completionCacheKey{uri: uri, line: position.Line, prefix: content.LastLine[:n]})
+	}
+
+	if !ok || entry.after != joinContentAfter(content) || !strings.HasPrefix(content.ContentBefore, entry.before) {
+		return nil, false
+	}
+
+	typed := content.ContentBefore[len(entry.before):]
+	var items []lsp.CompletionItem
+
+	for _, hint := range entry.hints {
+		rest, ok := strings.CutPrefix(hint, typed)
+
+		// Typing into a placeholder leaves the rest as plain text.
+		if !ok {
+			rest, ok = strings.CutPrefix(util.StripPlaceholders(hint), typed)
+		}
+
+		if ok && strings.TrimSpace(rest) != "" {
+			items = append(items, h.buildCompletionItem(rest, content, position, encoding, format))
+		}
+	}
+
+	return items, len(items) > 0
+}
+
+// joinContentAfter returns the rest of the cursor line followed by the lines
+// after it.
+func joinContentAfter(content util.ContentParts) string {
+	if content.ContentAfter == "" {
+		return content.ContentImmediatelyAfter
+	}
+
+	if content.ContentImmediatelyAfter == "" {
+		return content.ContentAfter
+	}
+	return content.ContentImmediatelyAfter + "\n" + content.ContentAfter
 }
 
 func findOverlapSuffix(hint, suffix string) int {
@@ -161,76 +501,86 @@ func findOverlapSuffix(hint, suffix string) int {
 	return 0
 }
 
-func (h *CompletionHandler) buildCompletionItem(hint string, content util.ContentParts, position lsp.Position) lsp.CompletionItem {
-	hint = strings.TrimSpace(hint)
-
-	lastLineTrimmed := strings.TrimSpace(content.LastLine)
-
-	if strings.HasPrefix(hint, lastLineTrimmed) {
-		hint = strings.TrimSpace(hint[len(lastLineTrimmed):])
+// buildCompletionItem turns a hint, the text to insert at the cursor, into an
+// item whose edit covers the partial identifier before the cursor, so the
+// client filters and replaces against it, and any text after the cursor that
+// the hint already ends with.
+func (h *CompletionHandler) buildCompletionItem(hint string, content util.ContentParts, position lsp.Position, encoding lsp.PositionEncoding, format completionFormat) lsp.CompletionItem {
+	word := content.LastLine[util.IdentifierStart(content.LastLine):]
+	snippet, isSnippet := util.ToSnippet(word + hint)
+	hint = util.StripPlaceholders(hint)
+	newText := word + hint
+	start := lsp.Position{Line: position.Line, Character: max(0, position.Character-encoding.Length(word))}
+	after := content.ContentImmediatelyAfter
+	end := position
+
+	if overlapLen := findOverlapSuffix(hint, after); overlapLen > 0 {
+		end.Character += encoding.Length(after[:overlapLen])
+	} else if after != "" && isIsolatedCloser(after) && util.ClosesUnopened(hint, rune(after[0])) {
+		end.Character++
 	}
 
-	lines := strings.Split(hint, "\n")
-	cleanLine := position.Line + len(lines) - 1
-	cleanCharacter := len(lines[len(lines)-1])
+	// A hint that starts on a new line is labelled by its first code line.
+	labelText := strings.TrimLeft(newText, " \t\r\n")
+	lines := strings.Split(labelText, "\n")
+	label := lines[0]
 
-	if cleanLine == position.Line {
-		cleanCharacter += position.Character
+	if len(label) > 20 {
+	} else if len(labelText) > 20 {
+		label = strings.TrimSpace(strings.ToValidUTF8(labelText[:20], ""))
 	}
 
-	label := lines[0]
+	item := lsp.CompletionItem{
+		Label:            label,
+		Kind:             1,
+		Preselect:        true,
+		Detail:           newText,
+		InsertTextFormat: 1,
+		SortText:         "00000",
+	}
 
-	if len(label) > 20 {
-	} else if len(hint) > 20 {
-		label = strings.TrimSpace(hint[:20])
+	if format.snippets && isSnippet {
+		newText = snippet
+		item.InsertTextFormat = 2
 	}
 
-	overlapLen := findOverlapSuffix(hint, content.ContentImmediatelyAfter)
+	insertRange := lsp.Range{Start: start, End: end}
 
-	var additionalEdits []lsp.TextEdit
+	if !format.insertReplace {
+		item.TextEdit = &lsp.TextEdit{Range: insertRange, NewText: newText}
+		return item
+	}
 
-	if overlapLen > 0 {
-		additionalEdits = append(additionalEdits, lsp.TextEdit{
-			Range: lsp.Range{
-				Start: lsp.Position{Line: cleanLine, Character: cleanCharacter},
-				End:   lsp.Position{Line: cleanLine, Character: cleanCharacter + overlapLen},
-			},
-			NewText: "",
-		})
-	} else if content.ContentImmediatelyAfter != "" {
-		firstChar := content.ContentImmediatelyAfter[0]
+	// Replacing also consumes the rest of the identifier after the cursor.
+	replaceEnd := position
+	replaceEnd.Character += encoding.Length(after[:util.IdentifierEnd(after)])
 
-		if firstChar == ')' || firstChar == '}' || firstChar == ']' || firstChar == '>' {
-			restOfLine := content.ContentImmediatelyAfter[1:]
-			isIsolated := len(content.ContentImmediatelyAfter) == 1 ||
-				len(strings.TrimLeft(restOfLine, " \t")) == 0 ||
-				restOfLine[0] == '\n' || restOfLine[0] == '\r'
+	if replaceEnd.Character < end.Character {
+		replaceEnd = end
+	}
 
-			if isIsolated {
-				additionalEdits = append(additionalEdits, lsp.TextEdit{
-					Range: lsp.Range{
-						Start: lsp.Position{Line: cleanLine, Character: cleanCharacter},
-						End:   lsp.Position{Line: cleanLine, Character: cleanCharacter + 1},
-					},
-					NewText: "",
-				})
-			}
-		}
+	item.TextEdit = &lsp.InsertReplaceEdit{
+		NewText: newText,
+		Insert:  insertRange,
+		Replace: lsp.Range{Start: start, End: replaceEnd},
 	}
+	return item
+}
 
-	return lsp.CompletionItem{
-		Label:               label,
-		Kind:                1,
-		Preselect:           true,
-		Detail:              hint,
-		InsertText:          hint,
-		InsertTextFormat:    1,
-		SortText:            "00000",
-		AdditionalTextEdits: additionalEdits,
+// isIsolatedCloser reports whether the rest of the line is a lone closing
+// bracket, which a hint that closes it replaces.
+func isIsolatedCloser(after string) bool {
+	switch after[0] {
+	case ')', '}', ']', '>':
+	default:
+		return false
 	}
+
+	rest := after[1:]
+	return len(strings.TrimLeft(rest, " \t")) == 0 || rest[0] == '\n' || rest[0] == '\r'
 }
 
-func (h *CompletionHandler) sendEmptyCompletion(svc *lsp.Service, id *int) {
+func (h *CompletionHandler) sendEmptyCompletion(svc *lsp.Service, id *lsp.ID) {
 	svc.Send(&lsp.JSONRPCMessage{
 		ID: id,
 		Result: lsp.CompletionList{
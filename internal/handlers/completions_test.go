@@ -0,0 +1,420 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/leona/helix-assist/internal/config"
+	"github.com/leona/helix-assist/internal/lsp"
+	"github.com/leona/helix-assist/internal/providers"
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// fakeProvider returns the same hints for every completion. If block is set,
+// each completion signals started and then waits for block to be closed.
+type fakeProvider struct {
+	hints   []string
+	calls   atomic.Int32
+	started chan struct{}
+	block   chan struct{}
+}
+
+func (p *fakeProvider) Completion(ctx context.Context, req providers.CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	p.calls.Add(1)
+
+	if p.block != nil {
+		p.started <- struct{}{}
+
+		select {
+		case <-p.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return p.hints, nil
+}
+
+func (p *fakeProvider) Chat(ctx context.Context, query, content, filepath, languageID string) (*providers.ChatResponse, error) {
+	return nil, errors.New("not supported")
+}
+
+// completionConn runs a service with a completion handler over pipes and
+// speaks to it as the client.
+type completionConn struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	msgs chan map[string]json.RawMessage
+}
+
+func newCompletionConn(t *testing.T, provider providers.Provider) *completionConn {
+	t.Helper()
+
+	cfg := config.DefaultConfig()
+	cfg.Debounce = 0
+	cfg.EnableProgressSpinner = false
+
+	registry := providers.NewRegistry()
+	registry.Register("fake", provider)
+	registry.SetCurrent("fake")
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	svc := lsp.NewServiceWithIO(lsp.ServerCapabilities{}, lsp.NewLogger(lsp.LoggerOptions{}), "test", inR, outW)
+	svc.SetExitHandler(func() {})
+	NewCompletionHandler(cfg, registry).Register(svc)
+
+	c := &completionConn{t: t, in: inW, msgs: make(chan map[string]json.RawMessage, 100)}
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		svc.Start()
+	}()
+
+	go func() {
+		out := bufio.NewReader(outR)
+
+		for {
+			length := 0
+
+			for {
+				line, err := out.ReadString('\n')
+				if err != nil {
+					return
+				}
+
+				line = strings.TrimSpace(line)
+				if line == "" {
+					break
+				}
+
+				if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+					length, _ = strconv.Atoi(strings.TrimSpace(v))
+				}
+			}
+
+			body := make([]byte, length)
+			if _, err := io.ReadFull(out, body); err != nil {
+				return
+			}
+
+			var msg map[string]json.RawMessage
+			json.Unmarshal(body, &msg)
+			c.msgs <- msg
+		}
+	}()
+
+	t.Cleanup(func() {
+		inW.Close()
+		outR.Close()
+		<-done
+	})
+	return c
+}
+
+// send writes a request, or a notification if id is zero.
+func (c *completionConn) send(id int, method string, params any) {
+	c.t.Helper()
+
+	data, _ := json.Marshal(params)
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s`, method, data)
+
+	if id != 0 {
+		body += fmt.Sprintf(`,"id":%d`, id)
+	}
+	body += "}"
+
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *completionConn) open(uri, text string) {
+	c.send(0, lsp.EventDidOpen, lsp.DidOpenParams{TextDocument: lsp.TextDocumentItem{URI: uri, LanguageID: "go", Version: 1, Text: text}})
+}
+
+func (c *completionConn) change(uri string, version int, text string) {
+	c.send(0, lsp.EventDidChange, lsp.DidChangeParams{
+		TextDocument:   lsp.VersionedTextDocumentIdentifier{TextDocumentIdentifier: lsp.TextDocumentIdentifier{URI: uri}, Version: version},
+		ContentChanges: []lsp.ContentChange{{Text: text}},
+	})
+}
+
+func (c *completionConn) complete(id int, uri string, line, character int) {
+	c.send(id, lsp.EventCompletion, lsp.CompletionParams{
+		TextDocument: lsp.TextDocumentIdentifier{URI: uri},
+		Position:     lsp.Position{Line: line, Character: character},
+	})
+}
+
+// completion waits for the response to request id and returns the text of
+// its items.
+func (c *completionConn) completion(id int) []string {
+	c.t.Helper()
+	timeout := time.After(2 * time.Second)
+
+	for {
+		select {
+		case msg := <-c.msgs:
+			if _, ok := msg["method"]; ok || string(msg["id"]) != strconv.Itoa(id) {
+				continue
+			}
+
+			var list struct {
+				Items []struct {
+					TextEdit struct {
+						NewText string `json:"newText"`
+					} `json:"textEdit"`
+				} `json:"items"`
+			}
+
+			if err := json.Unmarshal(msg["result"], &list); err != nil {
+				c.t.Fatalf("response to %d: %s", id, msg["error"])
+			}
+
+			texts := []string{}
+
+			for _, item := range list.Items {
+				texts = append(texts, item.TextEdit.NewText)
+			}
+			return texts
+		case <-timeout:
+			c.t.Fatalf("no response to %d", id)
+			return nil
+		}
+	}
+}
+
+func TestBuildCompletionItem(t *testing.T) {
+	pipeline, err := util.NewPipeline(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := &CompletionHandler{pipeline: pipeline}
+
+	tests := []struct {
+		name    string
+		text    string // the cursor is at |
+		hint    string
+		newText string
+		end     int
+	}{
+		{"restated keyword", "\treturn|", "return x", "return x", 7},
+		{"operator after identifier", "\tif err|", " != nil {", "err != nil {", 7},
+		{"block on next line", "func f() {\n\tif x {|\n}", "\n\ty := 1\n", "\n\t\ty := 1", 7},
+		{"identifier being typed", "x := fmt.Spr|", "Sprintf(\"%d\", n)", "Sprintf(\"%d\", n)", 12},
+		{"closer already on the line", "foo(|)", "a, b)", "a, b", 4},
+		{"overlap with rest of line", "foo(|, b)", "a, b)", "a, b)", 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cursor := strings.Index(tt.text, "|")
+			text := strings.Replace(tt.text, "|", "", 1)
+			line := strings.Count(text[:cursor], "\n")
+			column := cursor - strings.LastIndex(text[:cursor], "\n") - 1
+			content := util.GetContent(text, line, column)
+			position := lsp.Position{Line: line, Character: column}
+
+			hint, ok := h.pipeline.Run(tt.hint, content)
+			if !ok {
+				t.Fatalf("hint %q dropped", tt.hint)
+			}
+
+			item := h.buildCompletionItem(hint, content, position, lsp.PositionEncodingUTF8, completionFormat{})
+			edit := item.TextEdit.(*lsp.TextEdit)
+
+			if edit.NewText != tt.newText {
+				t.Errorf("newText = %q, want %q", edit.NewText, tt.newText)
+			}
+
+			if edit.Range.End.Character != tt.end {
+				t.Errorf("range ends at %d, want %d", edit.Range.End.Character, tt.end)
+			}
+
+			if strings.TrimSpace(item.Label) == "" {
+				t.Error("empty label")
+			}
+		})
+	}
+}
+
+func TestBuildCompletionItemSnippet(t *testing.T) {
+	h := &CompletionHandler{}
+	content := util.GetContent("x := fmt.Spr", 0, 12)
+	position := lsp.Position{Line: 0, Character: 12}
+
+	item := h.buildCompletionItem("intf(⟦format⟧, $a)", content, position, lsp.PositionEncodingUTF8, completionFormat{snippets: true})
+	edit := item.TextEdit.(*lsp.TextEdit)
+
+	if item.InsertTextFormat != 2 || edit.NewText != "Sprintf(${1:format}, \\$a)" {
+		t.Errorf("got format %d text %q", item.InsertTextFormat, edit.NewText)
+	}
+
+	if item.Detail != "Sprintf(format, $a)" {
+		t.Errorf("detail = %q", item.Detail)
+	}
+}
+
+func TestBuildCompletionItemInsertReplace(t *testing.T) {
+	h := &CompletionHandler{}
+	content := util.GetContent("x := fmt.Sprfoo", 0, 12)
+	position := lsp.Position{Line: 0, Character: 12}
+
+	item := h.buildCompletionItem("intf(a)", content, position, lsp.PositionEncodingUTF8, completionFormat{insertReplace: true})
+	edit, ok := item.TextEdit.(*lsp.InsertReplaceEdit)
+
+	if !ok {
+		t.Fatalf("TextEdit is %T, want *lsp.InsertReplaceEdit", item.TextEdit)
+	}
+
+	if edit.NewText != "Sprintf(a)" || edit.Insert.Start.Character != 9 || edit.Insert.End.Character != 12 || edit.Replace.End.Character != 15 {
+		t.Errorf("got %q insert %+v replace %+v", edit.NewText, edit.Insert, edit.Replace)
+	}
+}
+
+func TestSkipAutomatic(t *testing.T) {
+	lang := config.LanguageConfig{TriggerCharacters: []string{"{", "(", " "}}
+	h := &CompletionHandler{cfg: &config.Config{}}
+
+	typed := func(ch string) *lsp.CompletionContext {
+		return &lsp.CompletionContext{TriggerKind: lsp.CompletionTriggerCharacter, TriggerCharacter: ch}
+	}
+
+	tests := []struct {
+		name       string
+		line       string
+		languageID string
+		context    *lsp.CompletionContext
+		skip       bool
+	}{
+		{"space in code", "x := ", "go", typed(" "), false},
+		{"space in string", `x := "hello `, "go", typed(" "), true},
+		{"space in comment", "// hello ", "go", typed(" "), true},
+		{"space after apostrophe in prose", "Let's write the ", "markdown", typed(" "), false},
+		{"bracket in string", `x := "f(`, "go", typed("("), false},
+		{"unlisted trigger character", "x.", "go", typed("."), true},
+		{"typing in string", `x := "hello w`, "go", &lsp.CompletionContext{TriggerKind: lsp.CompletionTriggerInvoked}, false},
+		{"no context in comment", "// hello w", "go", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params := lsp.CompletionParams{Context: tt.context}
+			content := util.GetContent(tt.line, 0, len(tt.line))
+
+			if reason := h.skipAutomatic(params, content, tt.languageID, lang); (reason != "") != tt.skip {
+				t.Errorf("skipAutomatic() = %q, want skip %v", reason, tt.skip)
+			}
+		})
+	}
+
+	h.cfg.CompleteInStrings = true
+
+	if reason := h.skipAutomatic(lsp.CompletionParams{Context: typed(" ")}, util.GetContent(`x := "a `, 0, 8), "go", lang); reason != "" {
+		t.Errorf("skipped with COMPLETE_IN_STRINGS: %q", reason)
+	}
+}
+
+func TestCompletionSuperseded(t *testing.T) {
+	provider := &fakeProvider{hints: []string{"intf(a)"}, started: make(chan struct{}, 2), block: make(chan struct{})}
+	c := newCompletionConn(t, provider)
+
+	c.open("file:///a.go", "x := fmt.Spr")
+	c.complete(1, "file:///a.go", 0, 12)
+
+	select {
+	case <-provider.started:
+	case <-time.After(2 * time.Second):
+		t.Fatal("provider not called")
+	}
+
+	c.complete(2, "file:///a.go", 0, 12)
+
+	if got := c.completion(1); len(got) != 0 {
+		t.Errorf("superseded completion = %q, want an empty list", got)
+	}
+
+	close(provider.block)
+
+	if got := c.completion(2); len(got) != 1 || got[0] != "Sprintf(a)" {
+		t.Errorf("latest completion = %q", got)
+	}
+}
+
+func TestCompletionTypeThrough(t *testing.T) {
+	provider := &fakeProvider{hints: []string{"intf(a)"}}
+	c := newCompletionConn(t, provider)
+
+	c.open("file:///a.go", "x := fmt.Spr")
+	c.complete(1, "file:///a.go", 0, 12)
+
+	if got := c.completion(1); len(got) != 1 || got[0] != "Sprintf(a)" {
+		t.Fatalf("first completion = %q", got)
+	}
+
+	c.change("file:///a.go", 2, "x := fmt.Sprin")
+	c.complete(2, "file:///a.go", 0, 14)
+
+	if got := c.completion(2); len(got) != 1 || got[0] != "Sprintf(a)" {
+		t.Errorf("typed-through completion = %q", got)
+	}
+
+	if n := provider.calls.Load(); n != 1 {
+		t.Errorf("provider called %d times, want 1", n)
+	}
+
+	// Typing something else on the line misses the cache.
+	c.change("file:///a.go", 3, "x := fmt.Sprx")
+	c.complete(3, "file:///a.go", 0, 13)
+	c.completion(3)
+
+	if n := provider.calls.Load(); n != 2 {
+		t.Errorf("provider called %d times after diverging, want 2", n)
+	}
+
+	// Closing the document drops what was cached for it.
+	c.send(0, lsp.EventDidClose, lsp.DidCloseParams{TextDocument: lsp.TextDocumentIdentifier{URI: "file:///a.go"}})
+	c.open("file:///a.go", "x := fmt.Sprx")
+	c.complete(4, "file:///a.go", 0, 13)
+	c.completion(4)
+
+	if n := provider.calls.Load(); n != 3 {
+		t.Errorf("provider called %d times after reopening, want 3", n)
+	}
+}
+
+func TestRelatedSnippetsSources(t *testing.T) {
+	cfg := config.DefaultConfig()
+	h := &CompletionHandler{cfg: cfg}
+	svc := lsp.NewServiceWithIO(lsp.ServerCapabilities{}, lsp.NewLogger(lsp.LoggerOptions{}), "test", strings.NewReader(""), io.Discard)
+
+	code := "func parseConfig(path string) (*Config, error) {\n\treturn loadConfig(path)\n}"
+	current := &lsp.Buffer{URI: "file:///a.go", LanguageID: "go", Text: "cfg, err := parseConfig(path"}
+
+	for _, buf := range []*lsp.Buffer{
+		current,
+		{URI: "file:///b.go", LanguageID: "go", Text: code},
+		{URI: "file:///.env", LanguageID: "env", Text: "parseConfig path API_KEY=secret"},
+		{URI: "untitled:1", LanguageID: "go", Text: code},
+	} {
+		svc.Buffers.Set(buf)
+	}
+
+	content := util.GetContent(current.Text, 0, len(current.Text))
+	snippets := h.relatedSnippets(svc, current, content)
+
+	if len(snippets) != 1 || snippets[0].FilePath != "/b.go" {
+		t.Errorf("got %+v, want only the snippet from /b.go", snippets)
+	}
+}
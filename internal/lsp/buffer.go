@@ -5,6 +5,9 @@ import (
 	"sync"
 )
 
+// Buffer is an open document. Stored buffers are never modified, so a
+// buffer returned by the store stays safe to read while later changes are
+// applied.
 type Buffer struct {
 	URI        string
 	Text       string
@@ -16,14 +19,28 @@ type BufferStore struct {
 	mu         sync.RWMutex
 	buffers    map[string]*Buffer
 	currentURI string
+	encoding   PositionEncoding
 }
 
 func NewBufferStore() *BufferStore {
 	return &BufferStore{
-		buffers: make(map[string]*Buffer),
+		buffers:  make(map[string]*Buffer),
+		encoding: PositionEncodingUTF16,
 	}
 }
 
+func (s *BufferStore) PositionEncoding() PositionEncoding {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.encoding
+}
+
+func (s *BufferStore) SetPositionEncoding(enc PositionEncoding) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.encoding = enc
+}
+
 func (s *BufferStore) Set(buf *Buffer) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -60,12 +77,32 @@ func (s *BufferStore) SetCurrentURI(uri string) {
 	s.currentURI = uri
 }
 
-func (s *BufferStore) UpdateText(uri string, version int, text string) {
+// ApplyChanges applies content changes in order. A change without a range
+// replaces the whole document, otherwise only the given range is replaced.
+func (s *BufferStore) ApplyChanges(uri string, version int, changes []ContentChange) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+
 	if buf, ok := s.buffers[uri]; ok {
-		buf.Text = text
-		buf.Version = version
+		text := buf.Text
+
+		for _, change := range changes {
+			if change.Range == nil {
+				text = change.Text
+				continue
+			}
+
+			start := offsetAt(text, change.Range.Start, s.encoding)
+			end := offsetAt(text, change.Range.End, s.encoding)
+
+			if end < start {
+				start, end = end, start
+			}
+
+			text = text[:start] + change.Text + text[end:]
+		}
+
+		s.buffers[uri] = &Buffer{URI: buf.URI, Text: text, Version: version, LanguageID: buf.LanguageID}
 	}
 	s.currentURI = uri
 }
@@ -74,6 +111,29 @@ func (s *BufferStore) Delete(uri string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	delete(s.buffers, uri)
+
+	if s.currentURI == uri {
+		s.currentURI = ""
+	}
+}
+
+// All returns a copy of every open buffer.
+func (s *BufferStore) All() []Buffer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	buffers := make([]Buffer, 0, len(s.buffers))
+
+	for _, buf := range s.buffers {
+		buffers = append(buffers, *buf)
+	}
+	return buffers
+}
+
+func (s *BufferStore) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.buffers)
 }
 
 func (s *BufferStore) GetContentFromRange(uri string, r Range) string {
@@ -101,3 +161,26 @@ func (s *BufferStore) GetContentFromRange(uri string, r Range) string {
 	selectedLines := lines[r.Start.Line : endLine+1]
 	return strings.Join(selectedLines, "\n")
 }
+
+// offsetAt converts a position to a byte offset in text, clamping positions
+// past the end of a line or the document.
+func offsetAt(text string, pos Position, enc PositionEncoding) int {
+	offset := 0
+
+	for line := 0; line < pos.Line; line++ {
+		next := strings.IndexByte(text[offset:], '\n')
+
+		if next == -1 {
+			return len(text)
+		}
+		offset += next + 1
+	}
+
+	lineEnd := strings.IndexByte(text[offset:], '\n')
+
+	if lineEnd == -1 {
+		lineEnd = len(text) - offset
+	}
+
+	return offset + enc.ByteOffset(text[offset:offset+lineEnd], pos.Character)
+}
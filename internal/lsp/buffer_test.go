@@ -0,0 +1,68 @@
+package lsp
+
+import "testing"
+
+func TestOffsetAt(t *testing.T) {
+	text := "ab\n😀c\nlast"
+
+	tests := []struct {
+		pos  Position
+		enc  PositionEncoding
+		want int
+	}{
+		{Position{0, 0}, PositionEncodingUTF16, 0},
+		{Position{0, 2}, PositionEncodingUTF16, 2},
+		{Position{0, 10}, PositionEncodingUTF16, 2},
+		{Position{1, 2}, PositionEncodingUTF16, 7},
+		{Position{1, 1}, PositionEncodingUTF32, 7},
+		{Position{1, 4}, PositionEncodingUTF8, 7},
+		{Position{2, 4}, PositionEncodingUTF16, 13},
+		{Position{5, 0}, PositionEncodingUTF16, 13},
+	}
+
+	for _, tt := range tests {
+		if got := offsetAt(text, tt.pos, tt.enc); got != tt.want {
+			t.Errorf("offsetAt(%+v, %s) = %d, want %d", tt.pos, tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestApplyChanges(t *testing.T) {
+	r := func(sl, sc, el, ec int) *Range {
+		return &Range{Start: Position{sl, sc}, End: Position{el, ec}}
+	}
+
+	tests := []struct {
+		name    string
+		text    string
+		changes []ContentChange
+		want    string
+	}{
+		{"insert", "ab\ncd", []ContentChange{{Range: r(1, 1, 1, 1), Text: "X"}}, "ab\ncXd"},
+		{"delete across lines", "ab\ncd", []ContentChange{{Range: r(0, 1, 1, 1), Text: ""}}, "ad"},
+		{"full replace", "ab", []ContentChange{{Text: "new"}}, "new"},
+		{"in order", "ab", []ContentChange{{Range: r(0, 2, 0, 2), Text: "c"}, {Range: r(0, 0, 0, 1), Text: ""}}, "bc"},
+		{"past end of line", "ab\ncd", []ContentChange{{Range: r(0, 9, 0, 9), Text: "!"}}, "ab!\ncd"},
+		{"after astral character", "😀x", []ContentChange{{Range: r(0, 2, 0, 3), Text: "y"}}, "😀y"},
+		{"reversed range", "abc", []ContentChange{{Range: r(0, 2, 0, 1), Text: ""}}, "ac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := NewBufferStore()
+			store.Set(&Buffer{URI: "file:///a", Text: tt.text, Version: 1})
+			old, _ := store.Get("file:///a")
+
+			store.ApplyChanges("file:///a", 2, tt.changes)
+			buf, _ := store.Get("file:///a")
+
+			if buf.Text != tt.want || buf.Version != 2 {
+				t.Errorf("got %q version %d, want %q version 2", buf.Text, buf.Version, tt.want)
+			}
+
+			if old.Text != tt.text || old.Version != 1 {
+				t.Errorf("earlier buffer modified: %q version %d", old.Text, old.Version)
+			}
+		})
+	}
+}
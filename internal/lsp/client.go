@@ -0,0 +1,54 @@
+package lsp
+
+import "sync"
+
+// Client holds what the client sent in its initialize request.
+type Client struct {
+	mu     sync.RWMutex
+	params InitializeParams
+}
+
+func NewClient() *Client {
+	return &Client{}
+}
+
+func (c *Client) set(params InitializeParams) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.params = params
+}
+
+func (c *Client) Capabilities() ClientCapabilities {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.params.Capabilities
+}
+
+func (c *Client) SupportsApplyEdit() bool {
+	caps := c.Capabilities()
+	return caps.Workspace != nil && caps.Workspace.ApplyEdit
+}
+
+func (c *Client) SupportsWorkDoneProgress() bool {
+	caps := c.Capabilities()
+	return caps.Window != nil && caps.Window.WorkDoneProgress
+}
+
+func (c *Client) SupportsSnippets() bool {
+	item := c.completionItemCapabilities()
+	return item != nil && item.SnippetSupport
+}
+
+func (c *Client) SupportsInsertReplace() bool {
+	item := c.completionItemCapabilities()
+	return item != nil && item.InsertReplaceSupport
+}
+
+func (c *Client) completionItemCapabilities() *CompletionItemClientCapabilities {
+	caps := c.Capabilities()
+
+	if caps.TextDocument == nil || caps.TextDocument.Completion == nil {
+		return nil
+	}
+	return caps.TextDocument.Completion.CompletionItem
+}
@@ -0,0 +1,96 @@
+package lsp
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// dispatcher runs tasks in order per key. Each key gets its own queue, drained
+// by a goroutine that exits once the queue is empty.
+type dispatcher struct {
+	mu     sync.Mutex
+	queues map[string]*taskQueue
+}
+
+type taskQueue struct {
+	tasks []func()
+}
+
+func newDispatcher() *dispatcher {
+	return &dispatcher{
+		queues: make(map[string]*taskQueue),
+	}
+}
+
+func (d *dispatcher) enqueue(key string, task func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if q, ok := d.queues[key]; ok {
+		q.tasks = append(q.tasks, task)
+		return
+	}
+
+	q := &taskQueue{tasks: []func(){task}}
+	d.queues[key] = q
+	go d.run(key, q)
+}
+
+func (d *dispatcher) run(key string, q *taskQueue) {
+	for {
+		d.mu.Lock()
+
+		if len(q.tasks) == 0 {
+			delete(d.queues, key)
+			d.mu.Unlock()
+			return
+		}
+
+		task := q.tasks[0]
+		q.tasks = q.tasks[1:]
+		d.mu.Unlock()
+
+		task()
+	}
+}
+
+// dispatch schedules the handlers for an incoming message. Notifications for a
+// document run in order on that document's queue, and other notifications run
+// in order on a shared queue. Requests run concurrently, but a request for a
+// document only starts once every notification queued before it for that
+// document has been handled.
+func (s *Service) dispatch(msg *JSONRPCMessage) {
+	if msg.Method == EventCancelRequest {
+		s.emit(msg.Method, msg)
+		return
+	}
+
+	uri := documentURI(msg.Params)
+
+	if msg.ID == nil {
+		s.dispatcher.enqueue(uri, func() {
+			s.emit(msg.Method, msg)
+		})
+		return
+	}
+
+	if uri == "" {
+		go s.emit(msg.Method, msg)
+		return
+	}
+
+	s.dispatcher.enqueue(uri, func() {
+		go s.emit(msg.Method, msg)
+	})
+}
+
+func documentURI(params json.RawMessage) string {
+	var p struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}
+
+	if len(params) == 0 || json.Unmarshal(params, &p) != nil {
+		return ""
+	}
+	return p.TextDocument.URI
+}
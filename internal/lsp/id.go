@@ -0,0 +1,57 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// ID is a JSON-RPC request ID, which may be either an integer or a string.
+type ID struct {
+	num      int64
+	str      string
+	isString bool
+}
+
+func NewIntID(n int64) ID {
+	return ID{num: n}
+}
+
+func NewStringID(s string) ID {
+	return ID{str: s, isString: true}
+}
+
+func (id ID) String() string {
+	if id.isString {
+		return strconv.Quote(id.str)
+	}
+	return strconv.FormatInt(id.num, 10)
+}
+
+func (id ID) MarshalJSON() ([]byte, error) {
+	if id.isString {
+		return json.Marshal(id.str)
+	}
+	return json.Marshal(id.num)
+}
+
+func (id *ID) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		*id = NewStringID(s)
+		return nil
+	}
+
+	var n int64
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("invalid request id %s: %w", data, err)
+	}
+	*id = NewIntID(n)
+	return nil
+}
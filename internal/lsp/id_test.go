@@ -0,0 +1,49 @@
+package lsp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestIDRoundTrip(t *testing.T) {
+	for _, data := range []string{`1`, `-7`, `"1"`, `"abc"`, `""`} {
+		var id ID
+		if err := json.Unmarshal([]byte(data), &id); err != nil {
+			t.Fatalf("unmarshal %s: %v", data, err)
+		}
+
+		got, err := json.Marshal(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != data {
+			t.Errorf("round trip of %s gave %s", data, got)
+		}
+	}
+}
+
+func TestIDInvalid(t *testing.T) {
+	for _, data := range []string{`1.5`, `true`, `{}`} {
+		var id ID
+		if err := json.Unmarshal([]byte(data), &id); err == nil {
+			t.Errorf("unmarshal %s: expected an error, got %v", data, id)
+		}
+	}
+}
+
+func TestIDKinds(t *testing.T) {
+	if NewIntID(1) == NewStringID("1") {
+		t.Error(`1 and "1" are the same ID`)
+	}
+
+	ids := map[ID]bool{NewIntID(1): true}
+
+	if ids[NewStringID("1")] {
+		t.Error(`"1" found under 1`)
+	}
+
+	if NewIntID(1).String() == NewStringID("1").String() {
+		t.Errorf("1 and \"1\" both print as %s", NewIntID(1))
+	}
+}
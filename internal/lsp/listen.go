@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// Listen opens a listener for an address of the form tcp://host:port or
+// unix:///path/to/socket.
+func Listen(addr string) (net.Listener, error) {
+	network, address, ok := strings.Cut(addr, "://")
+
+	if !ok || address == "" {
+		return nil, fmt.Errorf("invalid listen address %q: expected tcp://host:port or unix:///path", addr)
+	}
+
+	switch network {
+	case "tcp":
+		return net.Listen("tcp", address)
+	case "unix":
+		if err := removeStaleSocket(address); err != nil {
+			return nil, err
+		}
+		return net.Listen("unix", address)
+	default:
+		return nil, fmt.Errorf("unsupported listen network %q", network)
+	}
+}
+
+// removeStaleSocket removes a socket left at path by an earlier run. A socket
+// that still accepts connections belongs to a running server and, like
+// anything other than a socket, is left alone and reported.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("stat socket: %w", err)
+	}
+
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("listen address %s exists and is not a socket", path)
+	}
+
+	conn, err := net.Dial("unix", path)
+
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("listen address %s: %w", path, syscall.EADDRINUSE)
+	}
+
+	if !errors.Is(err, syscall.ECONNREFUSED) {
+		return fmt.Errorf("check socket: %w", err)
+	}
+
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("remove stale socket: %w", err)
+	}
+	return nil
+}
+
+// Serve accepts connections on ln and runs a separate service for each one
+// until the listener is closed.
+func Serve(ln net.Listener, logger *Logger, newService func(conn net.Conn) *Service) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return fmt.Errorf("accept: %w", err)
+		}
+
+		go func() {
+			defer conn.Close()
+			remote := conn.RemoteAddr().String()
+			logger.Log("accepted connection", "remote:", remote)
+
+			svc := newService(conn)
+			svc.SetExitHandler(func() {
+				conn.Close()
+			})
+
+			if err := svc.Start(); err != nil {
+				logger.Error("connection error:", remote, err.Error())
+			}
+			logger.Log("connection closed", "remote:", remote)
+		}()
+	}
+}
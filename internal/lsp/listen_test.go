@@ -0,0 +1,76 @@
+package lsp
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// socketDir returns a directory short enough for unix socket paths.
+func socketDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "ha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	dir := socketDir(t)
+
+	t.Run("live socket kept", func(t *testing.T) {
+		path := filepath.Join(dir, "live.sock")
+		ln, err := Listen("unix://" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+
+		if _, err := Listen("unix://" + path); !errors.Is(err, syscall.EADDRINUSE) {
+			t.Errorf("got %v, want address in use", err)
+		}
+
+		if conn, err := net.Dial("unix", path); err != nil {
+			t.Errorf("running server lost its socket: %v", err)
+		} else {
+			conn.Close()
+		}
+	})
+
+	t.Run("stale socket replaced", func(t *testing.T) {
+		path := filepath.Join(dir, "stale.sock")
+		ln, err := net.Listen("unix", path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.(*net.UnixListener).SetUnlinkOnClose(false)
+		ln.Close()
+
+		ln, err = Listen("unix://" + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ln.Close()
+	})
+
+	t.Run("regular file kept", func(t *testing.T) {
+		path := filepath.Join(dir, "file")
+		if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := Listen("unix://" + path); err == nil {
+			t.Error("expected an error for a regular file")
+		}
+
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("regular file removed: %v", err)
+		}
+	})
+}
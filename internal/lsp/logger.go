@@ -0,0 +1,357 @@
+package lsp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+func ParseLogLevel(s string) (LogLevel, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level %q", s)
+	}
+}
+
+const (
+	redacted        = "[REDACTED]"
+	minSecretLength = 8
+)
+
+// Patterns for credentials that are always redacted from log output. The
+// first group of each pattern is kept so the redacted value stays labelled.
+var defaultRedactPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`()sk-[A-Za-z0-9_-]{16,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`),
+	regexp.MustCompile(`(?i)("?x-api-key"?\s*[:=]\s*"?)[^\s",]+`),
+}
+
+type LoggerOptions struct {
+	Path string
+	// Level is the minimum level written to the log.
+	Level LogLevel
+	// JSON writes one JSON object per line instead of plain text.
+	JSON bool
+	// MaxSize is the size in bytes at which the log file is rotated. Zero
+	// disables rotation.
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept next to the log file.
+	MaxFiles int
+	// Secrets are literal values, such as API keys, removed from every line.
+	Secrets []string
+	// RedactPatterns are removed from every line in addition to the built-in
+	// credential patterns.
+	RedactPatterns []*regexp.Regexp
+}
+
+// LogSink receives every log line at or above its minimum level, after
+// redaction. It must not log through the same logger.
+type LogSink func(level LogLevel, message string)
+
+type logSink struct {
+	minLevel LogLevel
+	fn       LogSink
+}
+
+type Logger struct {
+	mu      sync.Mutex
+	file    *os.File
+	path    string
+	size    int64
+	enabled atomic.Bool
+	opts    LoggerOptions
+	sinksMu sync.RWMutex
+	sinks   []*logSink
+	// parent owns the file and redaction of a child logger.
+	parent *Logger
+}
+
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot determine home directory: %w", err)
+	}
+
+	if path == "~" {
+		return home, nil
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+func NewLogger(opts LoggerOptions) *Logger {
+	l := &Logger{opts: opts}
+
+	if opts.Path != "" {
+		expandedPath, err := expandHome(opts.Path)
+
+		if err != nil {
+			return l
+		}
+
+		dir := filepath.Dir(expandedPath)
+
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return l
+		}
+
+		l.path = expandedPath
+
+		if err := l.open(); err == nil {
+			l.enabled.Store(true)
+		}
+	}
+	return l
+}
+
+func (l *Logger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = info.Size()
+	return nil
+}
+
+// rotate shifts log.N-1 to log.N down to log to log.1, dropping the oldest.
+func (l *Logger) rotate() {
+	l.file.Close()
+
+	if l.opts.MaxFiles <= 0 {
+		os.Remove(l.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", l.path, l.opts.MaxFiles))
+
+		for i := l.opts.MaxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1))
+		}
+		os.Rename(l.path, l.path+".1")
+	}
+
+	if err := l.open(); err != nil {
+		l.enabled.Store(false)
+	}
+}
+
+// Child returns a logger that writes to the same file as l with the same
+// redaction, but has sinks of its own. Lines logged through the child also
+// reach the sinks of l, but not the other way round.
+func (l *Logger) Child() *Logger {
+	return &Logger{parent: l.root()}
+}
+
+func (l *Logger) root() *Logger {
+	if l.parent != nil {
+		return l.parent
+	}
+	return l
+}
+
+// AddSecret registers a value that is redacted from every subsequent line.
+func (l *Logger) AddSecret(secret string) {
+	if secret == "" {
+		return
+	}
+
+	l = l.root()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.opts.Secrets = append(l.opts.Secrets, secret)
+}
+
+// AddSink mirrors log lines at or above minLevel to fn, independently of the
+// file level. The returned function removes the sink.
+func (l *Logger) AddSink(minLevel LogLevel, fn LogSink) func() {
+	sink := &logSink{minLevel: minLevel, fn: fn}
+
+	l.sinksMu.Lock()
+	l.sinks = append(l.sinks, sink)
+	l.sinksMu.Unlock()
+
+	return func() {
+		l.sinksMu.Lock()
+		defer l.sinksMu.Unlock()
+
+		for i, s := range l.sinks {
+			if s == sink {
+				l.sinks = append(l.sinks[:i:i], l.sinks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (l *Logger) Enabled(level LogLevel) bool {
+	l = l.root()
+	return l.enabled.Load() && level >= l.opts.Level
+}
+
+func (l *Logger) sinksFor(level LogLevel) []*logSink {
+	l.sinksMu.RLock()
+	defer l.sinksMu.RUnlock()
+
+	var sinks []*logSink
+
+	for _, s := range l.sinks {
+		if level >= s.minLevel {
+			sinks = append(sinks, s)
+		}
+	}
+
+	if l.parent != nil {
+		sinks = append(sinks, l.parent.sinksFor(level)...)
+	}
+	return sinks
+}
+
+func (l *Logger) Debug(args ...any) {
+	l.write(LevelDebug, args)
+}
+
+// Log writes at info level.
+func (l *Logger) Log(args ...any) {
+	l.write(LevelInfo, args)
+}
+
+func (l *Logger) Warn(args ...any) {
+	l.write(LevelWarn, args)
+}
+
+func (l *Logger) Error(args ...any) {
+	l.write(LevelError, args)
+}
+
+func (l *Logger) redact(s string) string {
+	for _, secret := range l.opts.Secrets {
+		// Too short to redact without mangling ordinary words.
+		if len(secret) < minSecretLength {
+			continue
+		}
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+
+	for _, re := range defaultRedactPatterns {
+		s = re.ReplaceAllString(s, "${1}"+redacted)
+	}
+
+	for _, re := range l.opts.RedactPatterns {
+		s = re.ReplaceAllString(s, redacted)
+	}
+	return s
+}
+
+func (l *Logger) write(level LogLevel, args []any) {
+	sinks := l.sinksFor(level)
+	l = l.root()
+
+	if !l.Enabled(level) && len(sinks) == 0 {
+		return
+	}
+
+	parts := make([]string, 0, len(args))
+
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprintf("%v", arg))
+	}
+
+	l.mu.Lock()
+	message := l.redact(strings.Join(parts, " "))
+	l.mu.Unlock()
+
+	for _, s := range sinks {
+		s.fn(level, message)
+	}
+
+	if !l.Enabled(level) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	var line string
+
+	if l.opts.JSON {
+		data, _ := json.Marshal(struct {
+			Time    string `json:"time"`
+			Level   string `json:"level"`
+			Message string `json:"msg"`
+		}{now.Format(time.RFC3339Nano), level.String(), message})
+		line = string(data) + "\n"
+	} else {
+		line = strings.ToUpper(level.String()) + " " + now.Format(time.RFC3339) + " --> " + message + "\n\n"
+	}
+
+	if l.opts.MaxSize > 0 && l.size > 0 && l.size+int64(len(line)) > l.opts.MaxSize {
+		l.rotate()
+
+		if !l.enabled.Load() {
+			return
+		}
+	}
+
+	n, _ := l.file.WriteString(line)
+	l.size += int64(n)
+}
+
+// Close closes the log file. Closing a child logger does nothing.
+func (l *Logger) Close() {
+	if l.parent != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		l.file.Close()
+	}
+}
@@ -0,0 +1,72 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestLoggerRedaction(t *testing.T) {
+	l := NewLogger(LoggerOptions{
+		Secrets:        []string{"hunter2hunter2", "short"},
+		RedactPatterns: []*regexp.Regexp{regexp.MustCompile(`token=\w+`)},
+	})
+	l.AddSecret("added-later-secret")
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"password hunter2hunter2 used", "password [REDACTED] used"},
+		{"a short word", "a short word"},
+		{"key added-later-secret", "key [REDACTED]"},
+		{"openai key sk-abcdefghijklmnop1234", "openai key [REDACTED]"},
+		{"sk-short", "sk-short"},
+		{"Authorization: Bearer abc.def-123", "Authorization: Bearer [REDACTED]"},
+		{`{"x-api-key": "secret-value", "model": "m"}`, `{"x-api-key": "[REDACTED]", "model": "m"}`},
+		{"X-Api-Key=secret-value", "X-Api-Key=[REDACTED]"},
+		{"url?token=abc123", "url?[REDACTED]"},
+	}
+
+	var got []string
+	l.AddSink(LevelDebug, func(level LogLevel, message string) {
+		got = append(got, message)
+	})
+
+	for _, tt := range tests {
+		l.Log(tt.line)
+	}
+
+	for i, tt := range tests {
+		if got[i] != tt.want {
+			t.Errorf("%q logged as %q, want %q", tt.line, got[i], tt.want)
+		}
+	}
+}
+
+func TestLoggerRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.log")
+	l := NewLogger(LoggerOptions{Path: path, MaxSize: 200, MaxFiles: 2})
+	defer l.Close()
+
+	for i := 0; i < 20; i++ {
+		l.Log(strings.Repeat("x", 50))
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if info.Size() > 200 {
+			t.Errorf("%s is %d bytes, over the limit", filepath.Base(name), info.Size())
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("more than MaxFiles rotated files kept: %v", err)
+	}
+}
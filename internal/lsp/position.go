@@ -0,0 +1,122 @@
+package lsp
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// PositionEncoding is the unit Position.Character is counted in.
+type PositionEncoding string
+
+const (
+	PositionEncodingUTF8  PositionEncoding = "utf-8"
+	PositionEncodingUTF16 PositionEncoding = "utf-16"
+	PositionEncodingUTF32 PositionEncoding = "utf-32"
+)
+
+// NegotiatePositionEncoding picks the encoding to use from the ones offered by
+// the client. UTF-8 is preferred since it matches how buffers are stored, and
+// UTF-16 is the protocol default when the client offers nothing we support.
+func NegotiatePositionEncoding(offered []PositionEncoding) PositionEncoding {
+	for _, preferred := range []PositionEncoding{PositionEncodingUTF8, PositionEncodingUTF32, PositionEncodingUTF16} {
+		for _, enc := range offered {
+			if enc == preferred {
+				return enc
+			}
+		}
+	}
+	return PositionEncodingUTF16
+}
+
+func (e PositionEncoding) runeUnits(r rune) int {
+	switch e {
+	case PositionEncodingUTF8:
+		return utf8.RuneLen(r)
+	case PositionEncodingUTF32:
+		return 1
+	default:
+		if r >= 0x10000 {
+			return 2
+		}
+		return 1
+	}
+}
+
+// Length returns the number of code units in s.
+func (e PositionEncoding) Length(s string) int {
+	if e == PositionEncodingUTF8 {
+		return len(s)
+	}
+
+	units := 0
+
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			units++
+		} else {
+			units += e.runeUnits(r)
+		}
+		i += size
+	}
+
+	return units
+}
+
+// ByteOffset converts a character offset within line to a byte offset,
+// clamping to the end of the line. Offsets that fall inside a multi-unit
+// character resolve to the start of that character.
+func (e PositionEncoding) ByteOffset(line string, character int) int {
+	if character <= 0 {
+		return 0
+	}
+
+	if e == PositionEncodingUTF8 {
+		if character >= len(line) {
+			return len(line)
+		}
+
+		for character > 0 && !utf8.RuneStart(line[character]) {
+			character--
+		}
+		return character
+	}
+
+	units := 0
+
+	for i := 0; i < len(line); {
+		r, size := utf8.DecodeRuneInString(line[i:])
+		w := 1
+
+		if r != utf8.RuneError || size != 1 {
+			w = e.runeUnits(r)
+		}
+
+		if units+w > character {
+			return i
+		}
+
+		units += w
+		i += size
+	}
+
+	return len(line)
+}
+
+// Character converts a byte offset within line to a character offset.
+func (e PositionEncoding) Character(line string, byteOffset int) int {
+	if byteOffset > len(line) {
+		byteOffset = len(line)
+	}
+	return e.Length(line[:max(byteOffset, 0)])
+}
+
+// ByteColumn returns the byte offset of pos within its line of text.
+func (e PositionEncoding) ByteColumn(text string, pos Position) int {
+	lines := strings.Split(text, "\n")
+
+	if pos.Line < 0 || pos.Line >= len(lines) {
+		return pos.Character
+	}
+	return e.ByteOffset(lines[pos.Line], pos.Character)
+}
@@ -0,0 +1,77 @@
+package lsp
+
+import "testing"
+
+func TestByteOffset(t *testing.T) {
+	// "a" is 1 byte, "é" 2 bytes and 1 UTF-16 unit, "😀" 4 bytes and 2 UTF-16
+	// units.
+	line := "aé😀b"
+
+	tests := []struct {
+		enc       PositionEncoding
+		character int
+		want      int
+	}{
+		{PositionEncodingUTF8, 0, 0},
+		{PositionEncodingUTF8, 1, 1},
+		{PositionEncodingUTF8, 2, 1},
+		{PositionEncodingUTF8, 3, 3},
+		{PositionEncodingUTF8, 5, 3},
+		{PositionEncodingUTF8, 7, 7},
+		{PositionEncodingUTF8, 100, 8},
+		{PositionEncodingUTF16, 2, 3},
+		{PositionEncodingUTF16, 3, 3},
+		{PositionEncodingUTF16, 4, 7},
+		{PositionEncodingUTF16, 5, 8},
+		{PositionEncodingUTF32, 2, 3},
+		{PositionEncodingUTF32, 3, 7},
+		{PositionEncodingUTF32, -1, 0},
+	}
+
+	for _, tt := range tests {
+		if got := tt.enc.ByteOffset(line, tt.character); got != tt.want {
+			t.Errorf("%s ByteOffset(%d) = %d, want %d", tt.enc, tt.character, got, tt.want)
+		}
+	}
+}
+
+func TestLengthAndCharacter(t *testing.T) {
+	line := "aé😀b"
+
+	tests := []struct {
+		enc  PositionEncoding
+		want int
+	}{
+		{PositionEncodingUTF8, 8},
+		{PositionEncodingUTF16, 5},
+		{PositionEncodingUTF32, 4},
+	}
+
+	for _, tt := range tests {
+		if got := tt.enc.Length(line); got != tt.want {
+			t.Errorf("%s Length() = %d, want %d", tt.enc, got, tt.want)
+		}
+
+		if got := tt.enc.Character(line, len(line)); got != tt.want {
+			t.Errorf("%s Character() = %d, want %d", tt.enc, got, tt.want)
+		}
+	}
+}
+
+func TestNegotiatePositionEncoding(t *testing.T) {
+	tests := []struct {
+		offered []PositionEncoding
+		want    PositionEncoding
+	}{
+		{nil, PositionEncodingUTF16},
+		{[]PositionEncoding{PositionEncodingUTF16, PositionEncodingUTF8}, PositionEncodingUTF8},
+		{[]PositionEncoding{PositionEncodingUTF32, PositionEncodingUTF16}, PositionEncodingUTF32},
+		{[]PositionEncoding{"utf-7"}, PositionEncodingUTF16},
+	}
+
+	for _, tt := range tests {
+		if got := NegotiatePositionEncoding(tt.offered); got != tt.want {
+			t.Errorf("NegotiatePositionEncoding(%v) = %s, want %s", tt.offered, got, tt.want)
+		}
+	}
+}
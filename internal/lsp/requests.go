@@ -0,0 +1,146 @@
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+)
+
+type inflightRequest struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// trackRequest registers an incoming request so it can be cancelled by the
+// client until a response has been sent for it, and returns its context.
+func (s *Service) trackRequest(id ID) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+
+	if prev, ok := s.inflight[id]; ok {
+		prev.cancel()
+	}
+	s.inflight[id] = &inflightRequest{ctx: ctx, cancel: cancel}
+	return ctx
+}
+
+// finishRequest removes a request from the in-flight table and cancels its
+// context. It reports whether the request was still in flight.
+func (s *Service) finishRequest(id ID) bool {
+	s.requestsMu.Lock()
+	req, ok := s.inflight[id]
+	delete(s.inflight, id)
+	s.requestsMu.Unlock()
+
+	if ok {
+		req.cancel()
+	}
+	return ok
+}
+
+// cancelAll cancels every in-flight request, used once the connection ends.
+func (s *Service) cancelAll() {
+	s.requestsMu.Lock()
+	defer s.requestsMu.Unlock()
+
+	for id, req := range s.inflight {
+		req.cancel()
+		delete(s.inflight, id)
+	}
+}
+
+// Context returns the context of a request. It is cancelled when the client
+// sends $/cancelRequest or once a response has been sent, which may happen
+// before the request's handler starts.
+func (s *Service) Context(msg *JSONRPCMessage) context.Context {
+	if msg.ctx == nil {
+		return context.Background()
+	}
+	return msg.ctx
+}
+
+func (s *Service) cancelRequest(msg *JSONRPCMessage) {
+	var params CancelParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		s.Logger.Error("cancelRequest parse error:", err.Error())
+		return
+	}
+
+	s.requestsMu.Lock()
+	_, ok := s.inflight[params.ID]
+	s.requestsMu.Unlock()
+
+	if !ok {
+		return
+	}
+
+	s.Logger.Log("cancelling request:", params.ID)
+	s.SendError(&params.ID, ErrorRequestCancelled, "request cancelled")
+}
+
+// Request sends a request to the client and waits for its response. The
+// response result is decoded into result when it is non-nil.
+func (s *Service) Request(ctx context.Context, method string, params any, result any) error {
+	id := NewIntID(atomic.AddInt64(&s.nextID, 1))
+	ch := make(chan *JSONRPCMessage, 1)
+
+	s.requestsMu.Lock()
+	s.pending[id] = ch
+	s.requestsMu.Unlock()
+
+	defer func() {
+		s.requestsMu.Lock()
+		delete(s.pending, id)
+		s.requestsMu.Unlock()
+	}()
+
+	s.Send(&JSONRPCMessage{
+		ID:     &id,
+		Method: method,
+		Params: mustMarshal(params),
+	})
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", method, ctx.Err())
+	case resp := <-ch:
+		if resp.Error != nil {
+			return fmt.Errorf("%s: %w", method, resp.Error)
+		}
+
+		if result == nil || resp.Result == nil {
+			return nil
+		}
+
+		data, err := json.Marshal(resp.Result)
+		if err != nil {
+			return fmt.Errorf("%s: marshal result: %w", method, err)
+		}
+
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("%s: parse result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// handleResponse delivers a response from the client to the request waiting
+// for it.
+func (s *Service) handleResponse(msg *JSONRPCMessage) {
+	s.requestsMu.Lock()
+	ch, ok := s.pending[*msg.ID]
+	s.requestsMu.Unlock()
+
+	if !ok {
+		s.Logger.Warn("response for unknown request:", *msg.ID)
+		return
+	}
+
+	select {
+	case ch <- msg:
+	default:
+	}
+}
@@ -6,106 +6,65 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
-type Logger struct {
-	mu      sync.Mutex
-	file    *os.File
-	enabled bool
-}
-
-func expandHome(path string) (string, error) {
-	if !strings.HasPrefix(path, "~") {
-		return path, nil
-	}
-
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return "", fmt.Errorf("cannot determine home directory: %w", err)
-	}
-
-	if path == "~" {
-		return home, nil
-	}
-	return filepath.Join(home, path[1:]), nil
-}
-
-func NewLogger(path string) *Logger {
-	l := &Logger{}
-
-	if path != "" {
-		expandedPath, err := expandHome(path)
-
-		if err != nil {
-			return l
-		}
-
-		dir := filepath.Dir(expandedPath)
-
-		if err := os.MkdirAll(dir, 0755); err != nil {
-			return l
-		}
-
-		f, err := os.OpenFile(expandedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
-
-		if err == nil {
-			l.file = f
-			l.enabled = true
-		}
-	}
-	return l
-}
-
-func (l *Logger) Log(args ...any) {
-	if !l.enabled {
-		return
-	}
-
-	l.mu.Lock()
-	defer l.mu.Unlock()
-	parts := make([]string, 0, len(args)+3)
-	parts = append(parts, "APP", time.Now().Format(time.RFC3339), "-->")
-
-	for _, arg := range args {
-		parts = append(parts, fmt.Sprintf("%v", arg))
-	}
-
-	l.file.WriteString(strings.Join(parts, " ") + "\n\n")
-}
-
-func (l *Logger) Close() {
-	if l.file != nil {
-		l.file.Close()
-	}
-}
-
 type EventHandler func(svc *Service, msg *JSONRPCMessage)
 
+// SaveHandler is called after a document has been saved, with the buffer as
+// stored after the save.
+type SaveHandler func(svc *Service, buf *Buffer)
+
 type Service struct {
-	Buffers      *BufferStore
-	Capabilities ServerCapabilities
-	Logger       *Logger
-	Version      string
-	handlers     map[string][]EventHandler
-	mu           sync.RWMutex
-	stdin        io.Reader
-	stdout       io.Writer
+	Buffers           *BufferStore
+	Workspace         *Workspace
+	Client            *Client
+	Capabilities      ServerCapabilities
+	Logger            *Logger
+	Version           string
+	handlers          map[string][]EventHandler
+	saveHandlers      []SaveHandler
+	mu                sync.RWMutex
+	dispatcher        *dispatcher
+	inflight          map[ID]*inflightRequest
+	pending           map[ID]chan *JSONRPCMessage
+	requestsMu        sync.Mutex
+	nextID            int64
+	nextProgressToken int64
+	stdin             io.Reader
+	stdout            io.Writer
+	exit              func()
+	stopped           atomic.Bool
+	trace             *Trace
+	clientLogLevel    *LogLevel
+	removeLogSink     func()
 }
 
 func NewService(capabilities ServerCapabilities, logger *Logger, version string) *Service {
+	return NewServiceWithIO(capabilities, logger, version, os.Stdin, os.Stdout)
+}
+
+// NewServiceWithIO creates a service that reads messages from in and writes
+// them to out instead of using stdin and stdout.
+func NewServiceWithIO(capabilities ServerCapabilities, logger *Logger, version string, in io.Reader, out io.Writer) *Service {
 	svc := &Service{
 		Buffers:      NewBufferStore(),
+		Workspace:    NewWorkspace(),
+		Client:       NewClient(),
 		Capabilities: capabilities,
 		Logger:       logger,
 		Version:      version,
 		handlers:     make(map[string][]EventHandler),
-		stdin:        os.Stdin,
-		stdout:       os.Stdout,
+		dispatcher:   newDispatcher(),
+		inflight:     make(map[ID]*inflightRequest),
+		pending:      make(map[ID]chan *JSONRPCMessage),
+		stdin:        in,
+		stdout:       out,
+		exit:         func() { os.Exit(0) },
 	}
 	svc.registerDefaultHandlers()
 	return svc
@@ -113,24 +72,65 @@ func NewService(capabilities ServerCapabilities, logger *Logger, version string)
 
 func (s *Service) registerDefaultHandlers() {
 	s.On(EventInitialize, func(svc *Service, msg *JSONRPCMessage) {
+		var params InitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Error("initialize parse error:", err.Error())
+			svc.SendError(msg.ID, ErrorInvalidParams, "invalid initialize params: "+err.Error())
+			return
+		}
+
+		svc.Client.set(params)
+
+		root := params.RootURI
+
+		if root == "" && params.RootPath != "" {
+			root = PathToURI(params.RootPath)
+		}
+
+		svc.Workspace.SetRoot(root)
+		svc.Workspace.SetFolders(params.WorkspaceFolders)
+
+		if info := params.ClientInfo; info != nil {
+			svc.Logger.Log("client:", info.Name, info.Version)
+		}
+		svc.Logger.Log("workspace root:", svc.Workspace.Root(), "folders:", len(params.WorkspaceFolders))
+
+		var offered []PositionEncoding
+
+		if params.Capabilities.General != nil {
+			offered = params.Capabilities.General.PositionEncodings
+		}
+
+		encoding := NegotiatePositionEncoding(offered)
+		svc.Buffers.SetPositionEncoding(encoding)
+		svc.Logger.Log("negotiated position encoding:", encoding)
+
+		capabilities := svc.Capabilities
+		capabilities.PositionEncoding = encoding
+
 		svc.Send(&JSONRPCMessage{
 			JSONRPC: "2.0",
 			ID:      msg.ID,
 			Result: InitializeResult{
-				Capabilities: svc.Capabilities,
+				Capabilities: capabilities,
+				ServerInfo: &ServerInfo{
+					Name:    "helix-assist",
+					Version: svc.Version,
+				},
 			},
 		})
 	})
 
 	s.On(EventInitialized, func(svc *Service, msg *JSONRPCMessage) {
 		svc.Logger.Log("received initialized notification")
+		svc.attachLogSink()
 		svc.SendShowMessage(MessageTypeInfo, "helix-assist ("+svc.Version+") has started")
 	})
 
 	s.On(EventDidOpen, func(svc *Service, msg *JSONRPCMessage) {
 		var params DidOpenParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("didOpen parse error:", err.Error())
+			svc.Logger.Error("didOpen parse error:", err.Error())
 			return
 		}
 
@@ -147,19 +147,78 @@ func (s *Service) registerDefaultHandlers() {
 	s.On(EventDidChange, func(svc *Service, msg *JSONRPCMessage) {
 		var params DidChangeParams
 		if err := json.Unmarshal(msg.Params, &params); err != nil {
-			svc.Logger.Log("didChange parse error:", err.Error())
+			svc.Logger.Error("didChange parse error:", err.Error())
 			return
 		}
 
 		if len(params.ContentChanges) > 0 {
-			svc.Buffers.UpdateText(
+			svc.Buffers.ApplyChanges(
 				params.TextDocument.URI,
 				params.TextDocument.Version,
-				params.ContentChanges[0].Text,
+				params.ContentChanges,
 			)
 		}
 
-		svc.Logger.Log("received didChange", "version:", params.TextDocument.Version, "uri:", params.TextDocument.URI)
+		svc.Logger.Debug("received didChange", "version:", params.TextDocument.Version, "uri:", params.TextDocument.URI)
+	})
+
+	s.On(EventDidClose, func(svc *Service, msg *JSONRPCMessage) {
+		var params DidCloseParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Error("didClose parse error:", err.Error())
+			return
+		}
+
+		svc.Buffers.Delete(params.TextDocument.URI)
+		svc.ClearDiagnostics(params.TextDocument.URI)
+		svc.Logger.Log("received didClose", "uri:", params.TextDocument.URI, "open buffers:", svc.Buffers.Len())
+	})
+
+	s.On(EventDidSave, func(svc *Service, msg *JSONRPCMessage) {
+		var params DidSaveParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Error("didSave parse error:", err.Error())
+			return
+		}
+
+		buf, ok := svc.Buffers.Get(params.TextDocument.URI)
+		if !ok {
+			return
+		}
+
+		if params.Text != nil {
+			svc.Buffers.ApplyChanges(buf.URI, buf.Version, []ContentChange{{Text: *params.Text}})
+
+			// Buffers are replaced on change, so buf is still the pre-save one.
+			if buf, ok = svc.Buffers.Get(buf.URI); !ok {
+				return
+			}
+		}
+
+		svc.Logger.Log("received didSave", "uri:", params.TextDocument.URI)
+
+		svc.mu.RLock()
+		handlers := svc.saveHandlers
+		svc.mu.RUnlock()
+
+		for _, h := range handlers {
+			h(svc, buf)
+		}
+	})
+
+	s.On(EventDidChangeFolders, func(svc *Service, msg *JSONRPCMessage) {
+		var params DidChangeWorkspaceFoldersParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			svc.Logger.Error("didChangeWorkspaceFolders parse error:", err.Error())
+			return
+		}
+
+		svc.Workspace.ApplyChange(params.Event)
+		svc.Logger.Log("workspace folders changed", "added:", len(params.Event.Added), "removed:", len(params.Event.Removed))
+	})
+
+	s.On(EventCancelRequest, func(svc *Service, msg *JSONRPCMessage) {
+		svc.cancelRequest(msg)
 	})
 
 	s.On(EventShutdown, func(svc *Service, msg *JSONRPCMessage) {
@@ -176,26 +235,111 @@ func (s *Service) registerDefaultHandlers() {
 
 	s.On(EventExit, func(svc *Service, msg *JSONRPCMessage) {
 		svc.Logger.Log("received exit notification")
-		os.Exit(0)
+		svc.stopped.Store(true)
+		svc.exit()
+	})
+}
+
+// SetTrace records every message read and written by the service to trace.
+func (s *Service) SetTrace(trace *Trace) {
+	s.trace = trace
+}
+
+// SetExitHandler replaces what happens on the exit notification, which by
+// default exits the process.
+func (s *Service) SetExitHandler(fn func()) {
+	s.exit = fn
+}
+
+// SetClientLogLevel mirrors log lines at or above level to the client through
+// window/logMessage once it is initialized.
+func (s *Service) SetClientLogLevel(level LogLevel) {
+	s.clientLogLevel = &level
+}
+
+func (s *Service) attachLogSink() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.clientLogLevel == nil || s.removeLogSink != nil {
+		return
+	}
+
+	s.removeLogSink = s.Logger.AddSink(*s.clientLogLevel, func(level LogLevel, message string) {
+		if s.stopped.Load() {
+			return
+		}
+
+		// Written directly, as Send logs and would feed back into the sink.
+		s.write(&JSONRPCMessage{
+			JSONRPC: "2.0",
+			Method:  EventLogMessage,
+			Params: mustMarshal(LogMessageParams{
+				Type:    logMessageType(level),
+				Message: message,
+			}),
+		})
 	})
 }
 
+func (s *Service) detachLogSink() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.removeLogSink != nil {
+		s.removeLogSink()
+	}
+
+	// Keeps a late initialized notification from attaching a new sink.
+	s.removeLogSink = func() {}
+}
+
+func logMessageType(level LogLevel) MessageType {
+	switch level {
+	case LevelError:
+		return MessageTypeError
+	case LevelWarn:
+		return MessageTypeWarning
+	case LevelInfo:
+		return MessageTypeInfo
+	default:
+		return MessageTypeLog
+	}
+}
+
 func (s *Service) On(method string, handler EventHandler) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.handlers[method] = append(s.handlers[method], handler)
 }
 
+// OnDidSave registers a handler that runs after every textDocument/didSave.
+func (s *Service) OnDidSave(handler SaveHandler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saveHandlers = append(s.saveHandlers, handler)
+}
+
 func (s *Service) emit(method string, msg *JSONRPCMessage) {
 	s.mu.RLock()
 	handlers := s.handlers[method]
 	s.mu.RUnlock()
 
+	if len(handlers) == 0 && msg.ID != nil {
+		s.Logger.Warn("method not found:", method)
+		s.SendError(msg.ID, ErrorMethodNotFound, "method not found: "+method)
+		return
+	}
+
 	for _, handler := range handlers {
-		go func(h EventHandler) {
+		func(h EventHandler) {
 			defer func() {
 				if r := recover(); r != nil {
-					s.Logger.Log("handler panic:", method, r)
+					s.Logger.Error("handler panic:", method, r)
+
+					if msg.ID != nil {
+						s.SendError(msg.ID, ErrorInternalError, fmt.Sprintf("internal error: %v", r))
+					}
 				}
 			}()
 			h(s, msg)
@@ -205,20 +349,48 @@ func (s *Service) emit(method string, msg *JSONRPCMessage) {
 
 func (s *Service) Send(msg *JSONRPCMessage) {
 	msg.JSONRPC = "2.0"
-	data, err := json.Marshal(msg)
+
+	if msg.Method == "" && msg.ID != nil && !s.finishRequest(*msg.ID) {
+		s.Logger.Debug("dropping response for finished request:", *msg.ID)
+		return
+	}
+
+	data, err := s.write(msg)
 
 	if err != nil {
-		s.Logger.Log("marshal error:", err.Error())
+		s.Logger.Error("marshal error:", err.Error())
 		return
 	}
 
+	s.Logger.Debug("sent:", string(data))
+}
+
+// write frames and writes msg without logging.
+func (s *Service) write(msg *JSONRPCMessage) ([]byte, error) {
+	data, err := json.Marshal(msg)
+
+	if err != nil {
+		return nil, err
+	}
+
 	header := fmt.Sprintf("Content-Length: %d\r\n\r\n", len(data))
 	s.mu.Lock()
 	s.stdout.Write([]byte(header))
 	s.stdout.Write(data)
+	s.trace.Record(TraceOut, data)
 	s.mu.Unlock()
 
-	s.Logger.Log("sent:", string(data))
+	return data, nil
+}
+
+func (s *Service) SendError(id *ID, code int, message string) {
+	s.Send(&JSONRPCMessage{
+		ID: id,
+		Error: &RPCError{
+			Code:    code,
+			Message: message,
+		},
+	})
 }
 
 func (s *Service) SendDiagnostics(diagnostics []Diagnostic, timeoutMs int) {
@@ -255,14 +427,31 @@ func (s *Service) SendDiagnostics(diagnostics []Diagnostic, timeoutMs int) {
 	}
 }
 
-func (s *Service) SendProgressBegin(token, title string) {
+// ClearDiagnostics removes all diagnostics previously published for uri.
+func (s *Service) ClearDiagnostics(uri string) {
+	s.Send(&JSONRPCMessage{
+		Method: EventPublishDiagnostics,
+		Params: mustMarshal(PublishDiagnosticsParams{
+			URI:         uri,
+			Diagnostics: []Diagnostic{},
+		}),
+	})
+}
+
+// NewProgressToken returns a work-done progress token unique to this service.
+func (s *Service) NewProgressToken() string {
+	return fmt.Sprintf("helix-assist-%d", atomic.AddInt64(&s.nextProgressToken, 1))
+}
+
+func (s *Service) SendProgressBegin(token, title, message string) {
 	s.Send(&JSONRPCMessage{
 		Method: EventProgress,
 		Params: mustMarshal(ProgressParams{
 			Token: token,
 			Value: WorkDoneProgressBegin{
-				Kind:  "begin",
-				Title: title,
+				Kind:    "begin",
+				Title:   title,
+				Message: message,
 			},
 		}),
 	})
@@ -281,13 +470,14 @@ func (s *Service) SendProgressReport(token, message string) {
 	})
 }
 
-func (s *Service) SendProgressEnd(token string) {
+func (s *Service) SendProgressEnd(token, message string) {
 	s.Send(&JSONRPCMessage{
 		Method: EventProgress,
 		Params: mustMarshal(ProgressParams{
 			Token: token,
 			Value: WorkDoneProgressEnd{
-				Kind: "end",
+				Kind:    "end",
+				Message: message,
 			},
 		}),
 	})
@@ -304,7 +494,10 @@ func (s *Service) SendShowMessage(msgType MessageType, message string) {
 }
 
 func (s *Service) Start() error {
+	defer s.cancelAll()
+	defer s.detachLogSink()
 	reader := bufio.NewReader(s.stdin)
+	var seq uint64
 
 	for {
 		contentLength := 0
@@ -312,7 +505,7 @@ func (s *Service) Start() error {
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil {
-				if err == io.EOF {
+				if err == io.EOF || s.stopped.Load() {
 					return nil
 				}
 				return fmt.Errorf("read header: %w", err)
@@ -339,17 +532,37 @@ func (s *Service) Start() error {
 			return fmt.Errorf("read content: %w", err)
 		}
 
+		s.trace.Record(TraceIn, content)
+
 		var msg JSONRPCMessage
 		if err := json.Unmarshal(content, &msg); err != nil {
-			s.Logger.Log("parse error:", err.Error(), string(content))
+			s.Logger.Error("parse error:", err.Error())
+			s.Logger.Debug("unparsable message:", string(content))
+
+			if json.Valid(content) {
+				s.SendError(nil, ErrorInvalidRequest, "invalid request: "+err.Error())
+			} else {
+				s.SendError(nil, ErrorParseError, "parse error: "+err.Error())
+			}
 			continue
 		}
 
 		if msg.Method != EventDidChange && msg.Method != EventDidOpen {
-			s.Logger.Log("received:", string(content))
+			s.Logger.Debug("received:", string(content))
+		}
+
+		if msg.ID != nil && msg.Method == "" {
+			s.handleResponse(&msg)
+			continue
+		}
+
+		if msg.ID != nil {
+			msg.ctx = s.trackRequest(*msg.ID)
 		}
 
-		s.emit(msg.Method, &msg)
+		seq++
+		msg.seq = seq
+		s.dispatch(&msg)
 	}
 }
 
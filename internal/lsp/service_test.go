@@ -0,0 +1,225 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testConn runs a service over pipes and speaks to it as the client.
+type testConn struct {
+	t      *testing.T
+	svc    *Service
+	in     *io.PipeWriter
+	out    *bufio.Reader
+	closed chan struct{}
+}
+
+func newTestConn(t *testing.T) *testConn {
+	t.Helper()
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	svc := NewServiceWithIO(ServerCapabilities{}, NewLogger(LoggerOptions{}), "test", inR, outW)
+	svc.SetExitHandler(func() {})
+
+	c := &testConn{t: t, svc: svc, in: inW, out: bufio.NewReader(outR), closed: make(chan struct{})}
+
+	go func() {
+		defer close(c.closed)
+		svc.Start()
+	}()
+
+	t.Cleanup(func() {
+		inW.Close()
+		outR.Close()
+		<-c.closed
+	})
+	return c
+}
+
+// send writes a message with the given raw JSON id, or none if id is empty.
+func (c *testConn) send(id, method string, params any) {
+	c.t.Helper()
+
+	msg := fmt.Sprintf(`{"jsonrpc":"2.0","method":%q,"params":%s`, method, mustMarshal(params))
+	if id != "" {
+		msg += `,"id":` + id
+	}
+	c.sendRaw(msg + "}")
+}
+
+func (c *testConn) sendRaw(body string) {
+	c.t.Helper()
+
+	if _, err := fmt.Fprintf(c.in, "Content-Length: %d\r\n\r\n%s", len(body), body); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// recv returns the next message the service writes.
+func (c *testConn) recv() map[string]json.RawMessage {
+	c.t.Helper()
+
+	type result struct {
+		msg map[string]json.RawMessage
+		err error
+	}
+	done := make(chan result, 1)
+
+	go func() {
+		length := 0
+
+		for {
+			line, err := c.out.ReadString('\n')
+			if err != nil {
+				done <- result{err: err}
+				return
+			}
+
+			line = strings.TrimSpace(line)
+			if line == "" {
+				break
+			}
+
+			if v, ok := strings.CutPrefix(line, "Content-Length:"); ok {
+				length, _ = strconv.Atoi(strings.TrimSpace(v))
+			}
+		}
+
+		body := make([]byte, length)
+		if _, err := io.ReadFull(c.out, body); err != nil {
+			done <- result{err: err}
+			return
+		}
+
+		var msg map[string]json.RawMessage
+		done <- result{msg, json.Unmarshal(body, &msg)}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			c.t.Fatal(r.err)
+		}
+		return r.msg
+	case <-time.After(2 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+		return nil
+	}
+}
+
+func TestDidSaveWithText(t *testing.T) {
+	c := newTestConn(t)
+	saved := make(chan *Buffer, 1)
+	c.svc.OnDidSave(func(svc *Service, buf *Buffer) { saved <- buf })
+
+	c.send("", EventDidOpen, DidOpenParams{TextDocument: TextDocumentItem{URI: "file:///a.go", LanguageID: "go", Version: 1, Text: "old"}})
+	text := "new"
+	c.send("", EventDidSave, DidSaveParams{TextDocument: TextDocumentIdentifier{URI: "file:///a.go"}, Text: &text})
+
+	select {
+	case buf := <-saved:
+		if buf.Text != "new" || buf.LanguageID != "go" {
+			t.Errorf("save handler got %q (%s), want the saved text", buf.Text, buf.LanguageID)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("save handler not called")
+	}
+}
+
+func TestUnreadableMessage(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"not json", `{"jsonrpc":"2.0",`, ErrorParseError},
+		{"fractional id", `{"jsonrpc":"2.0","id":1.5,"method":"shutdown"}`, ErrorInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestConn(t)
+			c.sendRaw(tt.body)
+			msg := c.recv()
+
+			var rpcErr RPCError
+			json.Unmarshal(msg["error"], &rpcErr)
+
+			if rpcErr.Code != tt.code {
+				t.Errorf("error code = %d, want %d", rpcErr.Code, tt.code)
+			}
+
+			if id, ok := msg["id"]; !ok || string(id) != "null" {
+				t.Errorf("id = %s, want null", id)
+			}
+		})
+	}
+}
+
+func TestCancelRequest(t *testing.T) {
+	c := newTestConn(t)
+	cancelled := make(chan error, 1)
+
+	c.svc.On("test/slow", func(svc *Service, msg *JSONRPCMessage) {
+		ctx := svc.Context(msg)
+		<-ctx.Done()
+		cancelled <- ctx.Err()
+	})
+
+	c.send(`"a"`, "test/slow", struct{}{})
+	c.send("", EventCancelRequest, CancelParams{ID: NewStringID("a")})
+	msg := c.recv()
+
+	var rpcErr RPCError
+	json.Unmarshal(msg["error"], &rpcErr)
+
+	if string(msg["id"]) != `"a"` || rpcErr.Code != ErrorRequestCancelled {
+		t.Errorf("got id %s error %+v, want RequestCancelled for \"a\"", msg["id"], rpcErr)
+	}
+
+	select {
+	case err := <-cancelled:
+		if err == nil {
+			t.Error("request context not cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("request context not cancelled")
+	}
+}
+
+func TestRequestWaitsForEarlierChange(t *testing.T) {
+	c := newTestConn(t)
+	var changed atomic.Bool
+
+	c.svc.On(EventDidChange, func(svc *Service, msg *JSONRPCMessage) {
+		time.Sleep(50 * time.Millisecond)
+		changed.Store(true)
+	})
+
+	c.svc.On("test/read", func(svc *Service, msg *JSONRPCMessage) {
+		buf, _ := svc.Buffers.Get("file:///a.go")
+		svc.Send(&JSONRPCMessage{ID: msg.ID, Result: fmt.Sprintf("%s %v", buf.Text, changed.Load())})
+	})
+
+	doc := TextDocumentIdentifier{URI: "file:///a.go"}
+	c.send("", EventDidOpen, DidOpenParams{TextDocument: TextDocumentItem{URI: doc.URI, Version: 1, Text: "old"}})
+	c.send("", EventDidChange, DidChangeParams{
+		TextDocument:   VersionedTextDocumentIdentifier{TextDocumentIdentifier: doc, Version: 2},
+		ContentChanges: []ContentChange{{Text: "new"}},
+	})
+	c.send("1", "test/read", struct {
+		TextDocument TextDocumentIdentifier `json:"textDocument"`
+	}{doc})
+
+	if got := string(c.recv()["result"]); got != `"new true"` {
+		t.Errorf("request saw %s, want the change fully handled", got)
+	}
+}
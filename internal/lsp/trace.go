@@ -0,0 +1,105 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	TraceIn       = "in"
+	TraceOut      = "out"
+	TraceProvider = "provider"
+)
+
+// TraceEntry is one line of a session trace.
+type TraceEntry struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// Trace records framed messages to a JSONL file so a session can be replayed.
+type Trace struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+func NewTrace(path string) (*Trace, error) {
+	expandedPath, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(expandedPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+
+	return &Trace{
+		file: f,
+		enc:  json.NewEncoder(f),
+	}, nil
+}
+
+// Record appends a message to the trace. Data that is not valid JSON is
+// stored as a JSON string. It is safe to call on a nil trace.
+func (t *Trace) Record(direction string, data []byte) {
+	if t == nil {
+		return
+	}
+
+	message := json.RawMessage(data)
+
+	if !json.Valid(data) {
+		message = mustMarshal(string(data))
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.enc.Encode(TraceEntry{
+		Time:      time.Now(),
+		Direction: direction,
+		Message:   message,
+	})
+}
+
+func (t *Trace) Close() {
+	if t != nil {
+		t.file.Close()
+	}
+}
+
+func ReadTrace(path string) ([]TraceEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open trace: %w", err)
+	}
+	defer f.Close()
+
+	var entries []TraceEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry TraceEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("trace line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read trace: %w", err)
+	}
+	return entries, nil
+}
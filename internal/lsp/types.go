@@ -1,21 +1,41 @@
 package lsp
 
-import "encoding/json"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
 
 const (
-	EventDidOpen            = "textDocument/didOpen"
-	EventDidChange          = "textDocument/didChange"
-	EventCompletion         = "textDocument/completion"
-	EventCodeAction         = "textDocument/codeAction"
-	EventApplyEdit          = "workspace/applyEdit"
-	EventExecuteCommand     = "workspace/executeCommand"
-	EventInitialize         = "initialize"
-	EventInitialized        = "initialized"
-	EventShutdown           = "shutdown"
-	EventExit               = "exit"
-	EventPublishDiagnostics = "textDocument/publishDiagnostics"
-	EventProgress           = "$/progress"
-	EventShowMessage        = "window/showMessage"
+	EventDidOpen                = "textDocument/didOpen"
+	EventDidChange              = "textDocument/didChange"
+	EventDidClose               = "textDocument/didClose"
+	EventDidSave                = "textDocument/didSave"
+	EventCompletion             = "textDocument/completion"
+	EventCodeAction             = "textDocument/codeAction"
+	EventApplyEdit              = "workspace/applyEdit"
+	EventExecuteCommand         = "workspace/executeCommand"
+	EventDidChangeFolders       = "workspace/didChangeWorkspaceFolders"
+	EventInitialize             = "initialize"
+	EventInitialized            = "initialized"
+	EventShutdown               = "shutdown"
+	EventExit                   = "exit"
+	EventPublishDiagnostics     = "textDocument/publishDiagnostics"
+	EventProgress               = "$/progress"
+	EventWorkDoneProgressCreate = "window/workDoneProgress/create"
+	EventShowMessage            = "window/showMessage"
+	EventLogMessage             = "window/logMessage"
+	EventCancelRequest          = "$/cancelRequest"
+)
+
+const (
+	ErrorParseError       = -32700
+	ErrorInvalidRequest   = -32600
+	ErrorMethodNotFound   = -32601
+	ErrorInvalidParams    = -32602
+	ErrorInternalError    = -32603
+	ErrorRequestCancelled = -32800
+	ErrorRequestFailed    = -32803
 )
 
 type WorkDoneProgressBegin struct {
@@ -37,6 +57,10 @@ type WorkDoneProgressEnd struct {
 	Message string `json:"message,omitempty"`
 }
 
+type WorkDoneProgressCreateParams struct {
+	Token string `json:"token"`
+}
+
 type ProgressParams struct {
 	Token string `json:"token"`
 	Value any    `json:"value"`
@@ -51,6 +75,14 @@ const (
 	MessageTypeLog     MessageType = 4
 )
 
+type TextDocumentSyncKind int
+
+const (
+	TextDocumentSyncNone        TextDocumentSyncKind = 0
+	TextDocumentSyncFull        TextDocumentSyncKind = 1
+	TextDocumentSyncIncremental TextDocumentSyncKind = 2
+)
+
 type DiagnosticSeverity int
 
 const (
@@ -79,11 +111,42 @@ type Diagnostic struct {
 
 type JSONRPCMessage struct {
 	JSONRPC string          `json:"jsonrpc"`
-	ID      *int            `json:"id,omitempty"`
+	ID      *ID             `json:"id,omitempty"`
 	Method  string          `json:"method,omitempty"`
 	Params  json.RawMessage `json:"params,omitempty"`
 	Result  any             `json:"result,omitempty"`
 	Error   *RPCError       `json:"error,omitempty"`
+	seq     uint64
+	ctx     context.Context
+}
+
+// Seq returns the position of an incoming message in the order it was read,
+// as handlers for requests may start in a different order.
+func (m *JSONRPCMessage) Seq() uint64 {
+	return m.seq
+}
+
+// MarshalJSON always includes the result member of a successful response,
+// since a null result has to be sent explicitly, and the id member of an
+// error response, which is null when the request id could not be read.
+func (m JSONRPCMessage) MarshalJSON() ([]byte, error) {
+	type message JSONRPCMessage
+
+	if m.Method == "" && m.Error != nil && m.ID == nil {
+		return json.Marshal(struct {
+			message
+			ID *ID `json:"id"`
+		}{message: message(m)})
+	}
+
+	if m.Method != "" || m.Error != nil || m.Result != nil {
+		return json.Marshal(message(m))
+	}
+
+	return json.Marshal(struct {
+		message
+		Result any `json:"result"`
+	}{message: message(m)})
 }
 
 type RPCError struct {
@@ -91,10 +154,59 @@ type RPCError struct {
 	Message string `json:"message"`
 }
 
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("%s (code %d)", e.Message, e.Code)
+}
+
+type CancelParams struct {
+	ID ID `json:"id"`
+}
+
 type InitializeParams struct {
-	ProcessID    int    `json:"processId"`
-	RootURI      string `json:"rootUri"`
-	Capabilities any    `json:"capabilities"`
+	ProcessID        int                `json:"processId"`
+	ClientInfo       *ClientInfo        `json:"clientInfo,omitempty"`
+	RootPath         string             `json:"rootPath,omitempty"`
+	RootURI          string             `json:"rootUri"`
+	Capabilities     ClientCapabilities `json:"capabilities"`
+	WorkspaceFolders []WorkspaceFolder  `json:"workspaceFolders,omitempty"`
+}
+
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+type ClientCapabilities struct {
+	Workspace    *WorkspaceClientCapabilities    `json:"workspace,omitempty"`
+	TextDocument *TextDocumentClientCapabilities `json:"textDocument,omitempty"`
+	Window       *WindowClientCapabilities       `json:"window,omitempty"`
+	General      *GeneralClientCapabilities      `json:"general,omitempty"`
+}
+
+type WorkspaceClientCapabilities struct {
+	ApplyEdit        bool `json:"applyEdit,omitempty"`
+	WorkspaceFolders bool `json:"workspaceFolders,omitempty"`
+}
+
+type TextDocumentClientCapabilities struct {
+	Completion *CompletionClientCapabilities `json:"completion,omitempty"`
+}
+
+type CompletionClientCapabilities struct {
+	CompletionItem *CompletionItemClientCapabilities `json:"completionItem,omitempty"`
+}
+
+type CompletionItemClientCapabilities struct {
+	SnippetSupport       bool `json:"snippetSupport,omitempty"`
+	InsertReplaceSupport bool `json:"insertReplaceSupport,omitempty"`
+}
+
+type WindowClientCapabilities struct {
+	WorkDoneProgress bool `json:"workDoneProgress,omitempty"`
+}
+
+type GeneralClientCapabilities struct {
+	PositionEncodings []PositionEncoding `json:"positionEncodings,omitempty"`
 }
 
 type TextDocumentIdentifier struct {
@@ -123,7 +235,9 @@ type DidOpenParams struct {
 }
 
 type ContentChange struct {
-	Text string `json:"text"`
+	Range       *Range `json:"range,omitempty"`
+	RangeLength int    `json:"rangeLength,omitempty"`
+	Text        string `json:"text"`
 }
 
 type DidChangeParams struct {
@@ -131,16 +245,64 @@ type DidChangeParams struct {
 	ContentChanges []ContentChange                 `json:"contentChanges"`
 }
 
+type DidCloseParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type DidSaveParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Text         *string                `json:"text,omitempty"`
+}
+
+type WorkspaceFolder struct {
+	URI  string `json:"uri"`
+	Name string `json:"name"`
+}
+
+type WorkspaceFoldersChangeEvent struct {
+	Added   []WorkspaceFolder `json:"added"`
+	Removed []WorkspaceFolder `json:"removed"`
+}
+
+type DidChangeWorkspaceFoldersParams struct {
+	Event WorkspaceFoldersChangeEvent `json:"event"`
+}
+
+type CompletionTriggerKind int
+
+const (
+	CompletionTriggerInvoked                  CompletionTriggerKind = 1
+	CompletionTriggerCharacter                CompletionTriggerKind = 2
+	CompletionTriggerForIncompleteCompletions CompletionTriggerKind = 3
+)
+
+type CompletionContext struct {
+	TriggerKind      CompletionTriggerKind `json:"triggerKind"`
+	TriggerCharacter string                `json:"triggerCharacter,omitempty"`
+}
+
 type CompletionParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 	Position     Position               `json:"position"`
+	Context      *CompletionContext     `json:"context,omitempty"`
+}
+
+// Invoked reports whether completion was requested without a trigger
+// character. That covers the user explicitly asking for completions, but
+// also clients completing while an identifier is typed, so it does not by
+// itself mean the request was manual.
+func (p CompletionParams) Invoked() bool {
+	return p.Context != nil && p.Context.TriggerKind == CompletionTriggerInvoked
 }
 
 type CompletionItem struct {
-	Label               string     `json:"label"`
-	Kind                int        `json:"kind,omitempty"`
-	Detail              string     `json:"detail,omitempty"`
-	InsertText          string     `json:"insertText,omitempty"`
+	Label      string `json:"label"`
+	Kind       int    `json:"kind,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+	InsertText string `json:"insertText,omitempty"`
+	// TextEdit is either a *TextEdit or, for clients that support it, an
+	// *InsertReplaceEdit.
+	TextEdit            any        `json:"textEdit,omitempty"`
 	InsertTextFormat    int        `json:"insertTextFormat,omitempty"`
 	SortText            string     `json:"sortText,omitempty"`
 	Preselect           bool       `json:"preselect,omitempty"`
@@ -157,6 +319,14 @@ type TextEdit struct {
 	NewText string `json:"newText"`
 }
 
+// InsertReplaceEdit lets the client choose between inserting the completion
+// and replacing the identifier after the cursor.
+type InsertReplaceEdit struct {
+	NewText string `json:"newText"`
+	Insert  Range  `json:"insert"`
+	Replace Range  `json:"replace"`
+}
+
 type CodeActionContext struct {
 	Diagnostics []Diagnostic `json:"diagnostics"`
 }
@@ -200,21 +370,52 @@ type ApplyWorkspaceEditParams struct {
 	Edit  WorkspaceEdit `json:"edit"`
 }
 
+type ApplyWorkspaceEditResult struct {
+	Applied       bool   `json:"applied"`
+	FailureReason string `json:"failureReason,omitempty"`
+}
+
 type PublishDiagnosticsParams struct {
 	URI         string       `json:"uri"`
 	Diagnostics []Diagnostic `json:"diagnostics"`
 }
 
+type LogMessageParams struct {
+	Type    MessageType `json:"type"`
+	Message string      `json:"message"`
+}
+
 type ShowMessageParams struct {
 	Type    MessageType `json:"type"`
 	Message string      `json:"message"`
 }
 
 type ServerCapabilities struct {
-	TextDocumentSync       int                    `json:"textDocumentSync"`
-	CompletionProvider     *CompletionOptions     `json:"completionProvider,omitempty"`
-	CodeActionProvider     bool                   `json:"codeActionProvider,omitempty"`
-	ExecuteCommandProvider *ExecuteCommandOptions `json:"executeCommandProvider,omitempty"`
+	PositionEncoding       PositionEncoding             `json:"positionEncoding,omitempty"`
+	TextDocumentSync       TextDocumentSyncOptions      `json:"textDocumentSync"`
+	CompletionProvider     *CompletionOptions           `json:"completionProvider,omitempty"`
+	CodeActionProvider     bool                         `json:"codeActionProvider,omitempty"`
+	ExecuteCommandProvider *ExecuteCommandOptions       `json:"executeCommandProvider,omitempty"`
+	Workspace              *WorkspaceServerCapabilities `json:"workspace,omitempty"`
+}
+
+type TextDocumentSyncOptions struct {
+	OpenClose bool                 `json:"openClose"`
+	Change    TextDocumentSyncKind `json:"change"`
+	Save      *SaveOptions         `json:"save,omitempty"`
+}
+
+type SaveOptions struct {
+	IncludeText bool `json:"includeText"`
+}
+
+type WorkspaceServerCapabilities struct {
+	WorkspaceFolders *WorkspaceFoldersServerCapabilities `json:"workspaceFolders,omitempty"`
+}
+
+type WorkspaceFoldersServerCapabilities struct {
+	Supported           bool `json:"supported"`
+	ChangeNotifications bool `json:"changeNotifications"`
 }
 
 type CompletionOptions struct {
@@ -225,6 +426,12 @@ type ExecuteCommandOptions struct {
 	Commands []string `json:"commands"`
 }
 
+type ServerInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
 type InitializeResult struct {
 	Capabilities ServerCapabilities `json:"capabilities"`
+	ServerInfo   *ServerInfo        `json:"serverInfo,omitempty"`
 }
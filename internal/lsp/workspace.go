@@ -0,0 +1,90 @@
+package lsp
+
+import (
+	"net/url"
+	"path/filepath"
+	"sync"
+)
+
+type Workspace struct {
+	mu      sync.RWMutex
+	root    string
+	folders []WorkspaceFolder
+}
+
+func NewWorkspace() *Workspace {
+	return &Workspace{}
+}
+
+func (w *Workspace) Folders() []WorkspaceFolder {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	folders := make([]WorkspaceFolder, len(w.folders))
+	copy(folders, w.folders)
+	return folders
+}
+
+func (w *Workspace) SetFolders(folders []WorkspaceFolder) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.folders = append([]WorkspaceFolder(nil), folders...)
+}
+
+func (w *Workspace) ApplyChange(event WorkspaceFoldersChangeEvent) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	removed := make(map[string]bool, len(event.Removed))
+
+	for _, f := range event.Removed {
+		removed[f.URI] = true
+	}
+
+	folders := make([]WorkspaceFolder, 0, len(w.folders)+len(event.Added))
+
+	for _, f := range w.folders {
+		if !removed[f.URI] {
+			folders = append(folders, f)
+		}
+	}
+
+	w.folders = append(folders, event.Added...)
+}
+
+// Root returns the URI of the workspace root, falling back to the first
+// workspace folder when the client did not send a root URI.
+func (w *Workspace) Root() string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.root != "" {
+		return w.root
+	}
+
+	if len(w.folders) > 0 {
+		return w.folders[0].URI
+	}
+	return ""
+}
+
+func (w *Workspace) SetRoot(uri string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.root = uri
+}
+
+// URIToPath converts a file URI to a filesystem path.
+func URIToPath(uri string) string {
+	u, err := url.Parse(uri)
+
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+// PathToURI converts a filesystem path to a file URI.
+func PathToURI(path string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(path)}
+	return u.String()
+}
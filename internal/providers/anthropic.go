@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/leona/helix-assist/internal/lsp"
-	"github.com/leona/helix-assist/internal/util"
 )
 
 type AnthropicProvider struct {
@@ -58,7 +57,7 @@ type anthropicRequest struct {
 	MaxTokens   int                      `json:"max_tokens"`
 	System      []anthropicSystemContent `json:"system,omitempty"`
 	Messages    []anthropicMessage       `json:"messages"`
-	Temperature float64                  `json:"temperature,omitempty"`
+	Temperature *float64                 `json:"temperature,omitempty"`
 }
 
 type anthropicResponse struct {
@@ -69,21 +68,27 @@ type anthropicResponse struct {
 }
 
 func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
-	systemPrompt := BuildCompletionSystemPrompt(languageID)
-	userPrompt := BuildCompletionUserPrompt(filepath, req.ContentBefore, req.ContentAfter)
+	systemPrompt := BuildCompletionSystemPrompt(languageID, req.Placeholders)
+	userPrompt := BuildCompletionUserPrompt(filepath, req)
 
-	temperature := 0.0
+	maxTokens := 256
 
-	if numSuggestions > 1 {
-		temperature = 0.4
+	if req.MaxTokens > 0 {
+		maxTokens = req.MaxTokens
 	}
 
-	results := make([]string, 0, numSuggestions)
+	model := p.model
+
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	return fetchCandidates(ctx, req, numSuggestions, func(ctx context.Context, i int) ([]string, error) {
+		temperature := candidateTemperature(i, numSuggestions)
 
-	for i := 0; i < numSuggestions; i++ {
 		apiReq := anthropicRequest{
-			Model:     p.model,
-			MaxTokens: 256,
+			Model:     model,
+			MaxTokens: maxTokens,
 			System: []anthropicSystemContent{
 				{
 					Type:         "text",
@@ -91,7 +96,7 @@ func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionReques
 					CacheControl: &anthropicCacheControl{Type: "ephemeral"},
 				},
 			},
-			Temperature: temperature,
+			Temperature: &temperature,
 			Messages: []anthropicMessage{
 				{Role: "user", Content: userPrompt},
 			},
@@ -100,29 +105,24 @@ func (p *AnthropicProvider) Completion(ctx context.Context, req CompletionReques
 		resp, err := p.doRequest(ctx, "/v1/messages", apiReq)
 
 		if err != nil {
-			if len(results) > 0 {
-				break
-			}
 			return nil, err
 		}
 
 		var apiResp anthropicResponse
 
 		if err := json.Unmarshal(resp, &apiResp); err != nil {
-			if len(results) > 0 {
-				break
-			}
 			return nil, fmt.Errorf("parse response: %w", err)
 		}
 
+		var results []string
+
 		for _, content := range apiResp.Content {
 			if content.Type == "text" && content.Text != "" {
 				results = append(results, content.Text)
 			}
 		}
-	}
-
-	return util.UniqueStrings(results), nil
+		return results, nil
+	})
 }
 
 func (p *AnthropicProvider) Chat(ctx context.Context, query, content, filepath, languageID string) (*ChatResponse, error) {
@@ -131,6 +131,8 @@ func (p *AnthropicProvider) Chat(ctx context.Context, query, content, filepath,
 	systemPrompt := BuildChatSystemPrompt(languageID)
 	userContent := BuildChatUserPrompt(languageID, cleanFilepath, content, query)
 
+	temperature := 0.1
+
 	apiReq := anthropicRequest{
 		Model:     p.chatModel,
 		MaxTokens: 8192,
@@ -140,21 +142,21 @@ func (p *AnthropicProvider) Chat(ctx context.Context, query, content, filepath,
 				Text: systemPrompt,
 			},
 		},
-		Temperature: 0.1,
+		Temperature: &temperature,
 		Messages: []anthropicMessage{
 			{Role: "user", Content: userContent},
 		},
 	}
 
 	jsonReq, _ := json.MarshalIndent(apiReq, "", "  ")
-	p.logger.Log("DEBUG [Anthropic Chat]: Request:", string(jsonReq))
+	p.logger.Debug("[Anthropic Chat] request:", string(jsonReq))
 
 	resp, err := p.doRequest(ctx, "/v1/messages", apiReq)
 	if err != nil {
 		return nil, err
 	}
 
-	p.logger.Log("DEBUG [Anthropic Chat]: Raw response:", string(resp))
+	p.logger.Debug("[Anthropic Chat] raw response:", string(resp))
 
 	var apiResp anthropicResponse
 	if err := json.Unmarshal(resp, &apiResp); err != nil {
@@ -173,7 +175,7 @@ func (p *AnthropicProvider) Chat(ctx context.Context, query, content, filepath,
 		}
 	}
 
-	p.logger.Log("DEBUG [Anthropic Chat]: Extracted text:", resultText)
+	p.logger.Debug("[Anthropic Chat] extracted text:", resultText)
 	return &ChatResponse{Result: resultText}, nil
 }
 
@@ -0,0 +1,108 @@
+package providers
+
+import (
+	"context"
+	"time"
+
+	"github.com/leona/helix-assist/internal/util"
+)
+
+// Temperature range the extra candidates are spread over. The first
+// candidate is always requested at temperature zero.
+const (
+	minCandidateTemperature = 0.3
+	maxCandidateTemperature = 0.9
+)
+
+// candidateTemperature returns the sampling temperature for candidate i of
+// n, so that several candidates for the same prompt differ.
+func candidateTemperature(i, n int) float64 {
+	if i == 0 {
+		return 0
+	}
+
+	if n <= 2 {
+		return minCandidateTemperature
+	}
+	return minCandidateTemperature + (maxCandidateTemperature-minCandidateTemperature)*float64(i-1)/float64(n-2)
+}
+
+type candidateResult struct {
+	texts []string
+	err   error
+}
+
+// fetchCandidates calls fetch for each of n candidates, with at most
+// req.Concurrency in flight. It returns once every candidate has finished,
+// or once req.SoftDeadline has passed and at least one has succeeded, in
+// which case the others are cancelled. The deadline is soft: if no candidate
+// has succeeded by then, it keeps waiting until one does or all have failed.
+// An error is only returned if no candidate succeeded.
+func fetchCandidates(ctx context.Context, req CompletionRequest, n int, fetch func(ctx context.Context, i int) ([]string, error)) ([]string, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := req.Concurrency
+
+	if concurrency <= 0 || concurrency > n {
+		concurrency = n
+	}
+
+	sem := make(chan struct{}, concurrency)
+	done := make(chan candidateResult, n)
+
+	for i := 0; i < n; i++ {
+		go func() {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				done <- candidateResult{err: ctx.Err()}
+				return
+			}
+
+			defer func() { <-sem }()
+			texts, err := fetch(ctx, i)
+			done <- candidateResult{texts: texts, err: err}
+		}()
+	}
+
+	var deadline <-chan time.Time
+
+	if req.SoftDeadline > 0 {
+		timer := time.NewTimer(req.SoftDeadline)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+
+	var results []string
+	var firstErr error
+	expired := false
+
+	for finished := 0; finished < n; {
+		select {
+		case res := <-done:
+			finished++
+
+			if res.err != nil {
+				if firstErr == nil {
+					firstErr = res.err
+				}
+				continue
+			}
+
+			results = append(results, res.texts...)
+		case <-deadline:
+			deadline = nil
+			expired = true
+		}
+
+		if expired && len(results) > 0 {
+			break
+		}
+	}
+
+	if len(results) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return util.UniqueStrings(results), nil
+}
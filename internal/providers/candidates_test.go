@@ -0,0 +1,141 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCandidateTemperature(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []float64
+	}{
+		{1, []float64{0}},
+		{2, []float64{0, 0.3}},
+		{4, []float64{0, 0.3, 0.6, 0.9}},
+	}
+
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			if got := candidateTemperature(i, tt.n); got < want-1e-9 || got > want+1e-9 {
+				t.Errorf("candidateTemperature(%d, %d) = %v, want %v", i, tt.n, got, want)
+			}
+		}
+	}
+}
+
+// delayed returns candidate i's index as its text after delays[i].
+func delayed(delays []time.Duration, inflight, peak *atomic.Int32) func(ctx context.Context, i int) ([]string, error) {
+	return func(ctx context.Context, i int) ([]string, error) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		select {
+		case <-time.After(delays[i]):
+			return []string{fmt.Sprint(i)}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func TestFetchCandidates(t *testing.T) {
+	ms := time.Millisecond
+
+	tests := []struct {
+		name        string
+		req         CompletionRequest
+		delays      []time.Duration
+		want        []string
+		maxInFlight int32
+	}{
+		{
+			name:        "all finish",
+			delays:      []time.Duration{10 * ms, 20 * ms, 5 * ms},
+			want:        []string{"0", "1", "2"},
+			maxInFlight: 3,
+		},
+		{
+			name:        "concurrency limit",
+			req:         CompletionRequest{Concurrency: 2},
+			delays:      []time.Duration{10 * ms, 10 * ms, 10 * ms, 10 * ms},
+			want:        []string{"0", "1", "2", "3"},
+			maxInFlight: 2,
+		},
+		{
+			name:        "soft deadline keeps what arrived",
+			req:         CompletionRequest{SoftDeadline: 100 * ms},
+			delays:      []time.Duration{10 * ms, 2 * time.Second, 2 * time.Second},
+			want:        []string{"0"},
+			maxInFlight: 3,
+		},
+		{
+			name:        "soft deadline waits for the first",
+			req:         CompletionRequest{SoftDeadline: 10 * ms},
+			delays:      []time.Duration{100 * ms, 2 * time.Second},
+			want:        []string{"0"},
+			maxInFlight: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inflight, peak atomic.Int32
+			start := time.Now()
+
+			got, err := fetchCandidates(context.Background(), tt.req, len(tt.delays), delayed(tt.delays, &inflight, &peak))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			slices.Sort(got)
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+
+			if peak.Load() > tt.maxInFlight {
+				t.Errorf("%d candidates in flight, want at most %d", peak.Load(), tt.maxInFlight)
+			}
+
+			if time.Since(start) > time.Second {
+				t.Errorf("took %v, slow candidates were not cancelled", time.Since(start))
+			}
+		})
+	}
+}
+
+func TestFetchCandidatesErrors(t *testing.T) {
+	boom := errors.New("boom")
+
+	got, err := fetchCandidates(context.Background(), CompletionRequest{}, 3, func(ctx context.Context, i int) ([]string, error) {
+		if i == 1 {
+			return []string{"ok", "ok"}, nil
+		}
+		return nil, boom
+	})
+
+	if err != nil || !slices.Equal(got, []string{"ok"}) {
+		t.Errorf("partial failure: got %v, %v, want [ok], nil", got, err)
+	}
+
+	_, err = fetchCandidates(context.Background(), CompletionRequest{}, 2, func(ctx context.Context, i int) ([]string, error) {
+		return nil, boom
+	})
+
+	if !errors.Is(err, boom) {
+		t.Errorf("all failed: got %v, want %v", err, boom)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"time"
 
 	"github.com/leona/helix-assist/internal/lsp"
-	"github.com/leona/helix-assist/internal/util"
 )
 
 var reasoningModels = map[string]bool{
@@ -65,6 +64,8 @@ type responsesRequest struct {
 	MaxToolCalls int                    `json:"max_tool_calls,omitempty"`
 	Metadata     map[string]interface{} `json:"metadata,omitempty"`
 	Reasoning    *reasoningConfig       `json:"reasoning,omitempty"`
+	MaxTokens    int                    `json:"max_output_tokens,omitempty"`
+	Temperature  *float64               `json:"temperature,omitempty"`
 }
 
 type responsesResponse struct {
@@ -79,47 +80,57 @@ type responsesResponse struct {
 }
 
 func (p *OpenAIProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
-	instructions := BuildCompletionSystemPrompt(languageID)
-	userPrompt := BuildCompletionUserPrompt(filepath, req.ContentBefore, req.ContentAfter)
+	instructions := BuildCompletionSystemPrompt(languageID, req.Placeholders)
+	userPrompt := BuildCompletionUserPrompt(filepath, req)
 
-	results := make([]string, 0, numSuggestions)
+	model := p.model
 
-	for i := 0; i < numSuggestions; i++ {
+	if req.Model != "" {
+		model = req.Model
+	}
+
+	// Reasoning models take no temperature, so further candidates would only
+	// repeat the first.
+	if isReasoningModel(model) {
+		numSuggestions = 1
+	}
+
+	return fetchCandidates(ctx, req, numSuggestions, func(ctx context.Context, i int) ([]string, error) {
 		respReq := responsesRequest{
-			Model:        p.model,
+			Model:        model,
 			Instructions: instructions,
 			Input:        userPrompt,
 			Store:        false,
 			ServiceTier:  "priority",
 			MaxToolCalls: 0,
+			MaxTokens:    req.MaxTokens,
 			Metadata: map[string]interface{}{
 				"language": languageID,
 				"filepath": filepath,
 			},
 		}
 
-		if isReasoningModel(p.model) {
+		if isReasoningModel(model) {
 			respReq.Reasoning = &reasoningConfig{
 				Effort: "minimal",
 			}
+		} else if numSuggestions > 1 {
+			temperature := candidateTemperature(i, numSuggestions)
+			respReq.Temperature = &temperature
 		}
 
 		resp, err := p.doRequest(ctx, "/responses", respReq)
 		if err != nil {
-			if len(results) > 0 {
-				break
-			}
 			return nil, err
 		}
 
 		var respResp responsesResponse
 		if err := json.Unmarshal(resp, &respResp); err != nil {
-			if len(results) > 0 {
-				break
-			}
 			return nil, fmt.Errorf("parse response: %w", err)
 		}
 
+		var results []string
+
 		for _, output := range respResp.Output {
 			if output.Type == "message" {
 				for _, content := range output.Content {
@@ -129,9 +140,8 @@ func (p *OpenAIProvider) Completion(ctx context.Context, req CompletionRequest,
 				}
 			}
 		}
-	}
-
-	return util.UniqueStrings(results), nil
+		return results, nil
+	})
 }
 
 func (p *OpenAIProvider) Chat(ctx context.Context, query, content, filepath, languageID string) (*ChatResponse, error) {
@@ -160,14 +170,14 @@ func (p *OpenAIProvider) Chat(ctx context.Context, query, content, filepath, lan
 	}
 
 	jsonReq, _ := json.MarshalIndent(respReq, "", "  ")
-	p.logger.Log("DEBUG [OpenAI Chat]: Request:", string(jsonReq))
+	p.logger.Debug("[OpenAI Chat] request:", string(jsonReq))
 	resp, err := p.doRequest(ctx, "/responses", respReq)
 
 	if err != nil {
 		return nil, err
 	}
 
-	p.logger.Log("DEBUG [OpenAI Chat]: Raw response:", string(resp))
+	p.logger.Debug("[OpenAI Chat] raw response:", string(resp))
 	var respResp responsesResponse
 
 	if err := json.Unmarshal(resp, &respResp); err != nil {
@@ -193,7 +203,7 @@ func (p *OpenAIProvider) Chat(ctx context.Context, query, content, filepath, lan
 		return nil, fmt.Errorf("no completion found")
 	}
 
-	p.logger.Log("DEBUG [OpenAI Chat]: Extracted text:", resultText)
+	p.logger.Debug("[OpenAI Chat] extracted text:", resultText)
 	return &ChatResponse{Result: resultText}, nil
 }
 
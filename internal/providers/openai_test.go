@@ -0,0 +1,58 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+func TestOpenAICompletionCandidates(t *testing.T) {
+	var mu sync.Mutex
+	var temperatures []*float64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req responsesRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		temperatures = append(temperatures, req.Temperature)
+		mu.Unlock()
+
+		w.Write([]byte(`{"output":[{"type":"message","content":[{"type":"output_text","text":"x"}]}]}`))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		model    string
+		requests int
+	}{
+		{"gpt-4.1", 3},
+		{"gpt-5", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			temperatures = nil
+			p := NewOpenAIProvider("key", tt.model, "", server.URL, 5000, lsp.NewLogger(lsp.LoggerOptions{}))
+
+			if _, err := p.Completion(context.Background(), CompletionRequest{}, "/a.go", "go", 3); err != nil {
+				t.Fatal(err)
+			}
+
+			if len(temperatures) != tt.requests {
+				t.Fatalf("%d requests, want %d", len(temperatures), tt.requests)
+			}
+
+			for _, temperature := range temperatures {
+				if (temperature != nil) != (tt.requests > 1) {
+					t.Errorf("temperature sent: %v, want %v", temperature != nil, tt.requests > 1)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,22 @@
 package providers
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+
+	"github.com/leona/helix-assist/internal/util"
+)
+
+func BuildCompletionSystemPrompt(languageID string, placeholders bool) string {
+	placeholderRule := "- Provide meaningful placeholder values or expressions where appropriate"
+
+	if placeholders {
+		placeholderRule = fmt.Sprintf("- Provide meaningful placeholder values or expressions where appropriate, and wrap each value the user is likely to replace, such as arguments and literals, in %s and %s (e.g. fetch(%surl%s, %soptions%s))",
+			util.PlaceholderStart, util.PlaceholderEnd,
+			util.PlaceholderStart, util.PlaceholderEnd,
+			util.PlaceholderStart, util.PlaceholderEnd)
+	}
 
-func BuildCompletionSystemPrompt(languageID string) string {
 	return fmt.Sprintf(`You are a %s code completion assistant. Complete the code at the cursor position.
 
 Rules:
@@ -22,12 +36,27 @@ Context awareness:
 
 Completion style:
 - Prefer multi-line completions that form complete, meaningful additions
-- Provide meaningful placeholder values or expressions where appropriate
-- When completing control structures that are NOT yet closed in the after-cursor code, provide complete blocks with braces`, languageID, languageID)
+%s
+- When completing control structures that are NOT yet closed in the after-cursor code, provide complete blocks with braces`, languageID, languageID, placeholderRule)
 }
 
-func BuildCompletionUserPrompt(filepath, contentBefore, contentAfter string) string {
-	return fmt.Sprintf(`File: %s
+func BuildCompletionUserPrompt(filepath string, req CompletionRequest) string {
+	contentBefore := req.ContentBefore
+	contentAfter := req.ContentAfter
+
+	if req.OmittedBefore > 0 {
+		contentBefore = omittedLines(req.OmittedBefore) + "\n" + contentBefore
+
+		if req.Header != "" {
+			contentBefore = req.Header + "\n" + contentBefore
+		}
+	}
+
+	if req.OmittedAfter > 0 {
+		contentAfter += "\n" + omittedLines(req.OmittedAfter)
+	}
+
+	return buildRelatedSnippets(req.RelatedSnippets) + fmt.Sprintf(`File: %s
 
 Code before cursor:
 %s
@@ -40,6 +69,24 @@ Code after cursor (DO NOT duplicate or close delimiters that already exist here)
 Complete the code at the <CURSOR> position. The completion must fit seamlessly between the before and after sections.`, filepath, contentBefore, contentAfter)
 }
 
+func buildRelatedSnippets(snippets []RelatedSnippet) string {
+	if len(snippets) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Related code from other open files, for reference only:\n\n")
+
+	for _, s := range snippets {
+		fmt.Fprintf(&b, "--- %s\n%s\n\n", s.FilePath, s.Text)
+	}
+	return b.String()
+}
+
+func omittedLines(n int) string {
+	return fmt.Sprintf("[... %d lines omitted ...]", n)
+}
+
 func BuildChatSystemPrompt(languageID string) string {
 	return fmt.Sprintf(`You are an AI programming assistant specialized in %s.
 
@@ -4,11 +4,43 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"time"
 )
 
+// RelatedSnippet is code from another open file that resembles the code
+// around the cursor.
+type RelatedSnippet struct {
+	FilePath string
+	Text     string
+}
+
 type CompletionRequest struct {
 	ContentBefore string
 	ContentAfter  string
+	// Header holds the file's leading import and package lines when lines
+	// between it and ContentBefore were left out to fit the context budget.
+	Header string
+	// OmittedBefore and OmittedAfter count the lines left out before
+	// ContentBefore and after ContentAfter.
+	OmittedBefore int
+	OmittedAfter  int
+	// RelatedSnippets are shown to the model ahead of the current file.
+	RelatedSnippets []RelatedSnippet
+	// Placeholders asks for placeholder values to be wrapped in
+	// util.PlaceholderStart and util.PlaceholderEnd.
+	Placeholders bool
+	// MaxTokens limits the length of each suggestion. Zero uses the provider
+	// default.
+	MaxTokens int
+	// Model overrides the provider's completion model when set.
+	Model string
+	// Concurrency limits how many suggestions are requested at once. Zero
+	// requests them all at once.
+	Concurrency int
+	// SoftDeadline is how long to wait for every suggestion before returning
+	// the ones that have arrived. If none has arrived by then, the first one
+	// is still waited for. Zero waits for all of them.
+	SoftDeadline time.Duration
 }
 
 type ChatResponse struct {
@@ -53,6 +85,12 @@ func (r *Registry) SetCurrent(name string) error {
 	return nil
 }
 
+func (r *Registry) CurrentName() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.current
+}
+
 func (r *Registry) Get() (Provider, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
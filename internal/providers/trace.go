@@ -0,0 +1,124 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/leona/helix-assist/internal/lsp"
+)
+
+type providerRecord struct {
+	Method  string   `json:"method"`
+	Results []string `json:"results,omitempty"`
+	Result  string   `json:"result,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// TracingProvider records everything returned by another provider to a trace,
+// so a recorded session can later be replayed without calling the API.
+type TracingProvider struct {
+	provider Provider
+	trace    *lsp.Trace
+}
+
+func NewTracingProvider(provider Provider, trace *lsp.Trace) *TracingProvider {
+	return &TracingProvider{
+		provider: provider,
+		trace:    trace,
+	}
+}
+
+func (p *TracingProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	results, err := p.provider.Completion(ctx, req, filepath, languageID, numSuggestions)
+	p.record(providerRecord{Method: "completion", Results: results}, err)
+	return results, err
+}
+
+func (p *TracingProvider) Chat(ctx context.Context, query, content, filepath, languageID string) (*ChatResponse, error) {
+	resp, err := p.provider.Chat(ctx, query, content, filepath, languageID)
+	rec := providerRecord{Method: "chat"}
+
+	if resp != nil {
+		rec.Result = resp.Result
+	}
+
+	p.record(rec, err)
+	return resp, err
+}
+
+func (p *TracingProvider) record(rec providerRecord, err error) {
+	if err != nil {
+		rec.Error = err.Error()
+	}
+
+	data, _ := json.Marshal(rec)
+	p.trace.Record(lsp.TraceProvider, data)
+}
+
+// ReplayProvider returns the provider results recorded in a trace, in the
+// order they were recorded.
+type ReplayProvider struct {
+	mu          sync.Mutex
+	completions []providerRecord
+	chats       []providerRecord
+}
+
+func NewReplayProvider(entries []lsp.TraceEntry) (*ReplayProvider, error) {
+	p := &ReplayProvider{}
+
+	for _, entry := range entries {
+		if entry.Direction != lsp.TraceProvider {
+			continue
+		}
+
+		var rec providerRecord
+		if err := json.Unmarshal(entry.Message, &rec); err != nil {
+			return nil, fmt.Errorf("parse provider record: %w", err)
+		}
+
+		switch rec.Method {
+		case "completion":
+			p.completions = append(p.completions, rec)
+		case "chat":
+			p.chats = append(p.chats, rec)
+		}
+	}
+
+	return p, nil
+}
+
+func (p *ReplayProvider) next(records *[]providerRecord, method string) (providerRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(*records) == 0 {
+		return providerRecord{}, fmt.Errorf("no recorded %s result left in trace", method)
+	}
+
+	rec := (*records)[0]
+	*records = (*records)[1:]
+
+	if rec.Error != "" {
+		return rec, errors.New(rec.Error)
+	}
+	return rec, nil
+}
+
+func (p *ReplayProvider) Completion(ctx context.Context, req CompletionRequest, filepath, languageID string, numSuggestions int) ([]string, error) {
+	rec, err := p.next(&p.completions, "completion")
+	if err != nil {
+		return nil, err
+	}
+	return rec.Results, nil
+}
+
+func (p *ReplayProvider) Chat(ctx context.Context, query, content, filepath, languageID string) (*ChatResponse, error) {
+	rec, err := p.next(&p.chats, "chat")
+	if err != nil {
+		return nil, err
+	}
+	return &ChatResponse{Result: rec.Result}, nil
+}
@@ -0,0 +1,192 @@
+package util
+
+import (
+	"strings"
+)
+
+// Indentation used when a document has none to detect from.
+const defaultIndentWidth = 4
+
+// IndentUnit is one level of indentation: a tab or a number of spaces.
+type IndentUnit struct {
+	Tabs  bool
+	Width int
+}
+
+func (u IndentUnit) String() string {
+	if u.Tabs {
+		return "\t"
+	}
+	return strings.Repeat(" ", u.Width)
+}
+
+// DetectIndentUnit guesses the indentation of text from its lines: tabs if
+// more lines are indented with tabs than spaces, and otherwise the most
+// common step between the space indentation of successive lines.
+func DetectIndentUnit(text string) IndentUnit {
+	tabs, spaces := 0, 0
+	steps := make(map[int]int)
+	prev := 0
+
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		switch line[0] {
+		case '\t':
+			tabs++
+		case ' ':
+			spaces++
+		}
+
+		width := len(line) - len(strings.TrimLeft(line, " "))
+
+		if step := width - prev; step > 0 && step <= 8 {
+			steps[step]++
+		}
+		prev = width
+	}
+
+	if tabs > spaces {
+		return IndentUnit{Tabs: true, Width: 1}
+	}
+
+	best, count := defaultIndentWidth, 0
+
+	for step, n := range steps {
+		if n > count || (n == count && step < best) {
+			best, count = step, n
+		}
+	}
+	return IndentUnit{Width: best}
+}
+
+// hintIndentUnit guesses the indentation a model used for the continuation
+// lines of a hint, falling back to fallback.
+func hintIndentUnit(lines []string, fallback IndentUnit) IndentUnit {
+	unit := 0
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if line[0] == '\t' {
+			return IndentUnit{Tabs: true, Width: 1}
+		}
+
+		if width := len(line) - len(strings.TrimLeft(line, " ")); width > 0 {
+			unit = gcd(unit, width)
+		}
+	}
+
+	if unit < 2 || unit > 8 {
+		if fallback.Tabs {
+			return IndentUnit{Width: defaultIndentWidth}
+		}
+		return fallback
+	}
+	return IndentUnit{Width: unit}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// indentLevel splits the indentation of line into whole levels of unit and
+// leftover alignment spaces.
+func indentLevel(line string, unit IndentUnit) (level, extra int) {
+	if unit.Tabs {
+		tabs := len(line) - len(strings.TrimLeft(line, "\t"))
+		rest := line[tabs:]
+		return tabs, len(rest) - len(strings.TrimLeft(rest, " "))
+	}
+
+	width := len(line) - len(strings.TrimLeft(line, " "))
+	return width / unit.Width, width % unit.Width
+}
+
+func opensBlock(line string) bool {
+	line = strings.TrimSpace(line)
+
+	for _, suffix := range []string{"{", "(", "[", ":", "=>", "->", " do", " then", "=", "\\"} {
+		if strings.HasSuffix(line, suffix) {
+			return true
+		}
+	}
+	return line == "do" || line == "then" || line == "else"
+}
+
+func closesBlock(line string) bool {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return false
+	}
+
+	if strings.ContainsRune(")]}", rune(line[0])) {
+		return true
+	}
+
+	for _, keyword := range []string{"end", "else", "elif", "except", "finally", "fi", "done", "esac"} {
+		if line == keyword || strings.HasPrefix(line, keyword+" ") || strings.HasPrefix(line, keyword+":") {
+			return true
+		}
+	}
+	return false
+}
+
+// ReindentHint rewrites the indentation of the continuation lines of a
+// multi-line hint in the document's indent unit, relative to the cursor
+// line. The first continuation line is placed one level deeper than the
+// cursor line if the cursor line opens a block, one level shallower if the
+// continuation line closes one, and at the same level otherwise. The other
+// lines keep their level relative to it. A hint that starts with a new line
+// has an empty first line, so it runs after trimming, which keeps it.
+func ReindentHint(hint string, content ContentParts) (string, bool) {
+	lines := strings.Split(hint, "\n")
+
+	if len(lines) < 2 {
+		return hint, true
+	}
+
+	bufferUnit := DetectIndentUnit(content.ContentBefore + "\n" + content.ContentAfter)
+	modelUnit := hintIndentUnit(lines[1:], bufferUnit)
+	cursorLevel, _ := indentLevel(content.LastLine, bufferUnit)
+
+	first := 1
+
+	for first < len(lines) && strings.TrimSpace(lines[first]) == "" {
+		first++
+	}
+
+	if first == len(lines) {
+		return hint, true
+	}
+
+	anchor := cursorLevel
+
+	if opensBlock(content.LastLine + lines[0]) {
+		anchor++
+	} else if closesBlock(lines[first]) {
+		anchor--
+	}
+
+	modelBase, _ := indentLevel(lines[first], modelUnit)
+
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			lines[i] = ""
+			continue
+		}
+
+		level, extra := indentLevel(lines[i], modelUnit)
+		level = max(anchor+level-modelBase, 0)
+		lines[i] = strings.Repeat(bufferUnit.String(), level) + strings.Repeat(" ", extra) + strings.TrimLeft(lines[i], " \t")
+	}
+	return strings.Join(lines, "\n"), true
+}
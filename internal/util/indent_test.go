@@ -0,0 +1,107 @@
+package util
+
+import "testing"
+
+func TestDetectIndentUnit(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want IndentUnit
+	}{
+		{"tabs", "func f() {\n\tx := 1\n\tif x {\n\t\ty()\n\t}\n}", IndentUnit{Tabs: true, Width: 1}},
+		{"two spaces", "a:\n  b:\n    c: 1\n  d: 2", IndentUnit{Width: 2}},
+		{"four spaces", "def f():\n    if x:\n        pass\n    return", IndentUnit{Width: 4}},
+		{"no indentation", "a\nb\nc", IndentUnit{Width: defaultIndentWidth}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectIndentUnit(tt.text); got != tt.want {
+				t.Errorf("DetectIndentUnit() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReindentHint(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		hint   string
+		want   string
+	}{
+		{
+			name:   "python block opened on cursor line",
+			before: "def f():\n    while y:\n        if x:",
+			hint:   "\n  return 1\n  return 2",
+			want:   "\n            return 1\n            return 2",
+		},
+		{
+			name:   "model indentation relative to file",
+			before: "class A:\n  def f(self):\n    x = 1\n  def g(self):",
+			hint:   "\n        return 1\n        if x:\n            y",
+			want:   "\n    return 1\n    if x:\n      y",
+		},
+		{
+			name:   "spaces to tabs with closing line",
+			before: "func a() {\n\tx := 1\n\tif x {",
+			hint:   "\n    return\n}",
+			want:   "\n\t\treturn\n\t}",
+		},
+		{
+			name:   "tabs to spaces",
+			before: "def f():\n    pass\ndef g():",
+			hint:   "\n\treturn 1\n\tif x:\n\t\tpass",
+			want:   "\n    return 1\n    if x:\n        pass",
+		},
+		{
+			name:   "continuation after code on cursor line",
+			before: "x\n    foo(a,",
+			hint:   "b)\nbar()",
+			want:   "b)\n    bar()",
+		},
+		{
+			name:   "yaml mapping",
+			before: "a:\n  b: 1\n  c:",
+			hint:   "\n    d: 2\n    e:\n      f: 3",
+			want:   "\n    d: 2\n    e:\n      f: 3",
+		},
+		{
+			name:   "single line unchanged",
+			before: "    x = ",
+			hint:   "1",
+			want:   "1",
+		},
+		{
+			name:   "blank lines emptied",
+			before: "if x:",
+			hint:   "\n    a\n   \n    b",
+			want:   "\n    a\n\n    b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ReindentHint(tt.hint, contentAt(tt.before, ""))
+
+			if !ok || got != tt.want {
+				t.Errorf("ReindentHint() = %q, %v, want %q", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineReindentsAfterTrim(t *testing.T) {
+	pipeline, err := NewPipeline(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := contentAt("def f():\n    while y:\n        if x:", "")
+	got, ok := pipeline.Run("\n  return 1\n  return 2\n", content)
+	want := "\n            return 1\n            return 2"
+
+	if !ok || got != want {
+		t.Errorf("Run() = %q, %v, want %q", got, ok, want)
+	}
+}
@@ -0,0 +1,316 @@
+package util
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ProcessFunc transforms a completion suggestion given the code around the
+// cursor, or reports false to drop it.
+type ProcessFunc func(hint string, content ContentParts) (string, bool)
+
+type Processor struct {
+	Name    string
+	Process ProcessFunc
+}
+
+// Pipeline runs processors in order on each suggestion.
+type Pipeline []Processor
+
+// Processor names, usable to switch individual processors off.
+const (
+	ProcessFences   = "fences"
+	ProcessTrim     = "trim"
+	ProcessPrefix   = "prefix"
+	ProcessSuffix   = "suffix"
+	ProcessBrackets = "brackets"
+	ProcessIndent   = "indent"
+	ProcessEmpty    = "empty"
+)
+
+// Processors lists every post-processor in the order they run.
+var Processors = []Processor{
+	{ProcessFences, StripFences},
+	{ProcessTrim, TrimHint},
+	{ProcessPrefix, DedupePrefix},
+	{ProcessSuffix, DedupeSuffix},
+	{ProcessBrackets, TrimClosers},
+	{ProcessIndent, ReindentHint},
+	{ProcessEmpty, DropEmpty},
+}
+
+// Most lines compared when looking for restated or duplicated code.
+const maxDedupeLines = 10
+
+// NewPipeline returns every processor except the disabled ones. Unknown
+// names are reported, but the pipeline is still usable.
+func NewPipeline(disabled []string) (Pipeline, error) {
+	var unknown []string
+
+	for _, name := range disabled {
+		if !slices.ContainsFunc(Processors, func(p Processor) bool { return p.Name == name }) {
+			unknown = append(unknown, name)
+		}
+	}
+
+	pipeline := make(Pipeline, 0, len(Processors))
+
+	for _, p := range Processors {
+		if !slices.Contains(disabled, p.Name) {
+			pipeline = append(pipeline, p)
+		}
+	}
+
+	if len(unknown) > 0 {
+		return pipeline, fmt.Errorf("unknown post-processor %s", strings.Join(unknown, ", "))
+	}
+	return pipeline, nil
+}
+
+// Run applies each processor in turn, stopping as soon as one drops the hint.
+func (p Pipeline) Run(hint string, content ContentParts) (string, bool) {
+	for _, proc := range p {
+		var ok bool
+
+		if hint, ok = proc.Process(hint, content); !ok {
+			return "", false
+		}
+	}
+	return hint, true
+}
+
+// StripFences keeps only the code inside the first markdown code fence.
+func StripFences(hint string, _ ContentParts) (string, bool) {
+	lines := strings.Split(hint, "\n")
+	start := slices.IndexFunc(lines, isFence)
+
+	if start == -1 {
+		return hint, true
+	}
+
+	end := len(lines)
+
+	if i := slices.IndexFunc(lines[start+1:], isFence); i != -1 {
+		end = start + 1 + i
+	}
+	return strings.Join(lines[start+1:end], "\n"), true
+}
+
+func isFence(line string) bool {
+	return strings.HasPrefix(strings.TrimSpace(line), "```")
+}
+
+// TrimHint removes trailing whitespace. Leading whitespace is kept, as a
+// hint may start with a space or a new line, unless the cursor already
+// follows a space.
+func TrimHint(hint string, content ContentParts) (string, bool) {
+	hint = strings.TrimRightFunc(hint, unicode.IsSpace)
+
+	if followsSpace(content.LastLine) {
+		hint = strings.TrimLeft(hint, " \t")
+	}
+	return hint, true
+}
+
+func followsSpace(line string) bool {
+	return strings.HasSuffix(line, " ") || strings.HasSuffix(line, "\t")
+}
+
+// DedupePrefix drops the part of a hint that restates code before the
+// cursor: lines before the cursor line, the cursor line, or the identifier
+// being typed. Whitespace between restated code and the rest of the hint is
+// kept unless the cursor already follows a space.
+func DedupePrefix(hint string, content ContentParts) (string, bool) {
+	lastLineTrimmed := strings.TrimSpace(content.LastLine)
+	before := strings.Split(content.ContentBefore, "\n")
+	previous := before[:len(before)-1]
+	lines := strings.Split(hint, "\n")
+
+	// Restated lines only count when the cursor line is restated after them.
+	if lastLineTrimmed != "" {
+		for k := min(len(previous), len(lines)-1, maxDedupeLines); k > 0; k-- {
+			if linesEqual(lines[:k], previous[len(previous)-k:]) && strings.HasPrefix(strings.TrimSpace(lines[k]), lastLineTrimmed) {
+				hint = strings.Join(lines[k:], "\n")
+				break
+			}
+		}
+	}
+
+	if trimmed := strings.TrimLeft(hint, " \t"); lastLineTrimmed != "" && strings.HasPrefix(trimmed, lastLineTrimmed) {
+		rest := trimmed[len(lastLineTrimmed):]
+
+		if followsSpace(content.LastLine) {
+			rest = strings.TrimLeft(rest, " \t")
+		}
+		return rest, true
+	}
+
+	// Otherwise the hint may still restate the identifier being typed.
+	if word := content.LastLine[IdentifierStart(content.LastLine):]; word != "" {
+		hint = strings.TrimPrefix(hint, word)
+	}
+	return hint, true
+}
+
+// DedupeSuffix drops trailing lines of a hint that duplicate the lines after
+// the cursor line.
+func DedupeSuffix(hint string, content ContentParts) (string, bool) {
+	after := strings.Split(strings.TrimLeft(content.ContentAfter, "\n"), "\n")
+	lines := strings.Split(hint, "\n")
+
+	for k := min(len(after), len(lines)-1, maxDedupeLines); k > 0; k-- {
+		tail := lines[len(lines)-k:]
+
+		if linesEqual(tail, after[:k]) && strings.TrimSpace(strings.Join(tail, "")) != "" {
+			return strings.TrimRight(strings.Join(lines[:len(lines)-k], "\n"), " \t\n"), true
+		}
+	}
+	return hint, true
+}
+
+func linesEqual(a, b []string) bool {
+	return slices.EqualFunc(a, b, func(x, y string) bool {
+		return strings.TrimSpace(x) == strings.TrimSpace(y)
+	})
+}
+
+var bracketPairs = map[rune]rune{')': '(', ']': '[', '}': '{'}
+
+// TrimClosers removes closing brackets at the end of a hint that have no
+// opener in the hint when the rest of the cursor line already closes them.
+func TrimClosers(hint string, content ContentParts) (string, bool) {
+	unmatched := unmatchedClosers(hint)
+	trimmed := strings.TrimRightFunc(hint, unicode.IsSpace)
+	cut := len(trimmed)
+	var closers []rune
+
+	for cut > 0 {
+		r, size := utf8.DecodeLastRuneInString(trimmed[:cut])
+
+		if unicode.IsSpace(r) {
+			cut -= size
+			continue
+		}
+
+		if _, ok := bracketPairs[r]; !ok || !unmatched[cut-size] {
+			break
+		}
+
+		closers = append([]rune{r}, closers...)
+		cut -= size
+	}
+
+	if len(closers) == 0 {
+		return hint, true
+	}
+
+	after := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, content.ContentImmediatelyAfter)
+
+	if !strings.HasPrefix(after, string(closers)) {
+		return hint, true
+	}
+	return strings.TrimRightFunc(trimmed[:cut], unicode.IsSpace), true
+}
+
+// unmatchedClosers returns the byte offsets of closing brackets in text that
+// have no matching opener before them, skipping quoted strings.
+func unmatchedClosers(text string) map[int]bool {
+	unmatched := make(map[int]bool)
+	var stack []rune
+	var quote rune
+	escaped := false
+
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if escaped {
+				escaped = false
+			} else if r == '\\' {
+				escaped = true
+			} else if r == quote || r == '\n' {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '(' || r == '[' || r == '{':
+			stack = append(stack, r)
+		default:
+			opener, ok := bracketPairs[r]
+
+			if !ok {
+				continue
+			}
+
+			if len(stack) > 0 && stack[len(stack)-1] == opener {
+				stack = stack[:len(stack)-1]
+			} else {
+				unmatched[i] = true
+			}
+		}
+	}
+	return unmatched
+}
+
+// ClosesUnopened reports whether text has a closing bracket r with no opener
+// in text. Other characters, such as '>', only need to appear in text.
+func ClosesUnopened(text string, r rune) bool {
+	if _, ok := bracketPairs[r]; !ok {
+		return strings.ContainsRune(text, r)
+	}
+
+	for i := range unmatchedClosers(text) {
+		if rune(text[i]) == r {
+			return true
+		}
+	}
+	return false
+}
+
+// DropEmpty drops suggestions with nothing but whitespace.
+func DropEmpty(hint string, _ ContentParts) (string, bool) {
+	return hint, strings.TrimSpace(hint) != ""
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// IdentifierStart returns the byte offset at which the identifier ending at
+// the end of line starts.
+func IdentifierStart(line string) int {
+	i := len(line)
+
+	for i > 0 {
+		r, size := utf8.DecodeLastRuneInString(line[:i])
+
+		if !isIdentifierRune(r) {
+			break
+		}
+		i -= size
+	}
+	return i
+}
+
+// IdentifierEnd returns the length in bytes of the identifier that text
+// starts with.
+func IdentifierEnd(text string) int {
+	i := 0
+
+	for i < len(text) {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		if !isIdentifierRune(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
@@ -0,0 +1,154 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+type processCase struct {
+	name   string
+	before string
+	after  string
+	hint   string
+	want   string
+	drop   bool
+}
+
+func runProcessCases(t *testing.T, fn ProcessFunc, tests []processCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := fn(tt.hint, contentAt(tt.before, tt.after))
+
+			if ok == tt.drop {
+				t.Fatalf("kept = %v, want %v", ok, !tt.drop)
+			}
+
+			if ok && got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripFences(t *testing.T) {
+	runProcessCases(t, StripFences, []processCase{
+		{name: "no fence", hint: "foo()", want: "foo()"},
+		{name: "fenced", hint: "```go\nfoo()\nbar()\n```", want: "foo()\nbar()"},
+		{name: "text around fence", hint: "Here:\n```\nfoo()\n```\nDone.", want: "foo()"},
+		{name: "unterminated", hint: "```python\nfoo()", want: "foo()"},
+	})
+}
+
+func TestTrimHint(t *testing.T) {
+	runProcessCases(t, TrimHint, []processCase{
+		{name: "trailing whitespace", before: "x = ", hint: "1 \n\n", want: "1"},
+		{name: "leading space after identifier", before: "\tif err", hint: " != nil {", want: " != nil {"},
+		{name: "leading new line", before: "if x {", hint: "\n\ty := 1\n", want: "\n\ty := 1"},
+		{name: "leading space after space", before: "x = ", hint: "  1", want: "1"},
+		{name: "leading new line after space", before: "x = ", hint: "\n  1", want: "\n  1"},
+	})
+}
+
+func TestDedupePrefix(t *testing.T) {
+	runProcessCases(t, DedupePrefix, []processCase{
+		{name: "restated cursor line", before: "\treturn", hint: "return x", want: " x"},
+		{name: "restated cursor line after space", before: "\treturn ", hint: "return x", want: "x"},
+		{name: "restated identifier", before: "\tx := ret", hint: "return 1", want: "urn 1"},
+		{name: "restated previous lines", before: "a := 1\nb := 2\nif a", hint: "a := 1\nb := 2\nif a > b {", want: " > b {"},
+		{name: "restated line then new line", before: "if x {", hint: "if x {\n\ty := 1", want: "\n\ty := 1"},
+		{name: "leading space kept", before: "\tif err", hint: " != nil {", want: " != nil {"},
+		{name: "leading new line kept", before: "if x {", hint: "\n\ty := 1", want: "\n\ty := 1"},
+		{name: "blank cursor line", before: "    ", hint: "return 1", want: "return 1"},
+	})
+}
+
+func TestDedupeSuffix(t *testing.T) {
+	runProcessCases(t, DedupeSuffix, []processCase{
+		{name: "duplicated closing line", before: "if x {", after: "\n}\nfoo()", hint: "\n\ty()\n}", want: "\n\ty()"},
+		{name: "duplicated lines", before: "a(", after: "\nb()\nc()", hint: ")\nb()\nc()", want: ")"},
+		{name: "no duplicate", before: "if x {", after: "\n}", hint: "\n\ty()", want: "\n\ty()"},
+		{name: "whole hint kept", before: "x", after: "\n}", hint: "}", want: "}"},
+	})
+}
+
+func TestTrimClosers(t *testing.T) {
+	runProcessCases(t, TrimClosers, []processCase{
+		{name: "closer already after cursor", before: "foo(", after: ")", hint: "a, b)", want: "a, b"},
+		{name: "several closers", before: "foo(bar(", after: "))", hint: "x))", want: "x"},
+		{name: "closer not after cursor", before: "foo(", hint: "a, b)", want: "a, b)"},
+		{name: "matched closer kept", before: "x = ", after: ")", hint: "f(a)", want: "f(a)"},
+		{name: "closer in string kept", before: "s = ", after: ")", hint: `")"`, want: `")"`},
+	})
+}
+
+func TestDropEmpty(t *testing.T) {
+	runProcessCases(t, DropEmpty, []processCase{
+		{name: "empty", hint: "", drop: true},
+		{name: "whitespace", hint: " \n\t", drop: true},
+		{name: "code", hint: "x", want: "x"},
+	})
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline, err := NewPipeline(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runProcessCases(t, pipeline.Run, []processCase{
+		{name: "restated keyword", before: "\treturn", hint: "return x", want: " x"},
+		{name: "operator after identifier", before: "\tif err", hint: " != nil {", want: " != nil {"},
+		{name: "block on next line", before: "func f() {\n\tif x {", hint: "\n  y := 1\n", want: "\n\t\ty := 1"},
+		{name: "fenced restatement", before: "x := ", hint: "```go\nx := 1\n```", want: "1"},
+		{name: "closer after cursor", before: "foo(", after: ")", hint: "a)", want: "a"},
+		{name: "only restatement", before: "\treturn", hint: "return", drop: true},
+	})
+}
+
+func TestNewPipeline(t *testing.T) {
+	pipeline, err := NewPipeline([]string{ProcessTrim, "nope"})
+
+	if err == nil {
+		t.Error("expected an error for an unknown processor")
+	}
+
+	if len(pipeline) != len(Processors)-1 {
+		t.Fatalf("got %d processors, want %d", len(pipeline), len(Processors)-1)
+	}
+
+	for _, p := range pipeline {
+		if p.Name == ProcessTrim {
+			t.Error("disabled processor still in pipeline")
+		}
+	}
+}
+
+func TestClosesUnopened(t *testing.T) {
+	tests := []struct {
+		text string
+		r    rune
+		want bool
+	}{
+		{"a)", ')', true},
+		{"f(a)", ')', false},
+		{"f(a))", ')', true},
+		{`")"`, ')', false},
+		{"a>", '>', true},
+		{"a", '>', false},
+	}
+
+	for _, tt := range tests {
+		if got := ClosesUnopened(tt.text, tt.r); got != tt.want {
+			t.Errorf("ClosesUnopened(%q, %q) = %v, want %v", tt.text, tt.r, got, tt.want)
+		}
+	}
+}
+
+// contentAt returns the content parts for a cursor between before and after.
+func contentAt(before, after string) ContentParts {
+	line := strings.Count(before, "\n")
+	column := len(before) - strings.LastIndex(before, "\n") - 1
+	return GetContent(before+after, line, column)
+}
@@ -10,21 +10,31 @@ import (
 	"github.com/leona/helix-assist/internal/lsp"
 )
 
+const progressCreateTimeout = 2 * time.Second
+
+// ProgressIndicator reports a running operation to the client, using
+// work-done progress when the client supports it and falling back to a
+// spinner sent through window/showMessage.
 type ProgressIndicator struct {
 	svc            *lsp.Service
 	enabled        bool
+	title          string
+	providerName   string
 	updateInterval time.Duration
 	spinnerFrames  []string
 	ctx            context.Context
 	cancel         context.CancelFunc
+	done           chan struct{}
 	startTime      time.Time
 	mu             sync.Mutex
 }
 
-func NewProgressIndicator(svc *lsp.Service, cfg *config.Config) *ProgressIndicator {
+func NewProgressIndicator(svc *lsp.Service, cfg *config.Config, title, providerName string) *ProgressIndicator {
 	return &ProgressIndicator{
 		svc:            svc,
 		enabled:        cfg.EnableProgressSpinner,
+		title:          title,
+		providerName:   providerName,
 		updateInterval: time.Duration(cfg.ProgressUpdateInterval) * time.Millisecond,
 		spinnerFrames:  []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"},
 	}
@@ -37,18 +47,21 @@ func (p *ProgressIndicator) Start() {
 
 	p.mu.Lock()
 	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.done = make(chan struct{})
 	p.startTime = time.Now()
 	p.mu.Unlock()
 
-	go p.animate()
+	go p.run()
 }
 
+// Stop ends the progress and waits until the client has been told.
 func (p *ProgressIndicator) Stop() {
 	if !p.enabled {
 		return
 	}
 
 	p.mu.Lock()
+	done := p.done
 
 	if p.cancel != nil {
 		p.cancel()
@@ -56,6 +69,53 @@ func (p *ProgressIndicator) Stop() {
 	}
 
 	p.mu.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+func (p *ProgressIndicator) run() {
+	defer close(p.done)
+
+	if !p.svc.Client.SupportsWorkDoneProgress() {
+		p.animate()
+		return
+	}
+
+	token := p.svc.NewProgressToken()
+	ctx, cancel := context.WithTimeout(p.ctx, progressCreateTimeout)
+	err := p.svc.Request(ctx, lsp.EventWorkDoneProgressCreate, lsp.WorkDoneProgressCreateParams{Token: token}, nil)
+	cancel()
+
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	if err != nil {
+		p.svc.Logger.Warn("workDoneProgress/create failed, falling back to showMessage:", err.Error())
+		p.animate()
+		return
+	}
+
+	p.report(token)
+}
+
+func (p *ProgressIndicator) report(token string) {
+	ticker := time.NewTicker(p.updateInterval)
+	defer ticker.Stop()
+
+	p.svc.SendProgressBegin(token, p.title, p.providerName)
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			p.svc.SendProgressEnd(token, fmt.Sprintf("%s finished in %s", p.providerName, p.formatElapsed(time.Since(p.startTime))))
+			return
+		case <-ticker.C:
+			p.svc.SendProgressReport(token, fmt.Sprintf("%s (%s)", p.providerName, p.formatElapsed(time.Since(p.startTime))))
+		}
+	}
 }
 
 func (p *ProgressIndicator) animate() {
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SnippetSource is a document searched for related snippets.
+type SnippetSource struct {
+	URI  string
+	Text string
+}
+
+// Snippet is a window of lines from another document that resembles the
+// code around the cursor.
+type Snippet struct {
+	URI       string
+	StartLine int
+	Text      string
+	Score     float64
+}
+
+// Windows below this similarity are not considered related.
+const minSnippetScore = 0.1
+
+var identifierPattern = regexp.MustCompile(`[A-Za-z_][A-Za-z0-9_]+`)
+
+func identifierSet(lines ...[]string) map[string]struct{} {
+	set := make(map[string]struct{})
+
+	for _, tokens := range lines {
+		for _, token := range tokens {
+			set[token] = struct{}{}
+		}
+	}
+	return set
+}
+
+func jaccard(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+
+	for token := range a {
+		if _, ok := b[token]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// FindSimilarSnippets ranks windows of windowLines lines from sources by the
+// Jaccard similarity of their identifiers to query, and returns the best
+// non-overlapping ones that fit in budget tokens, most similar first.
+func FindSimilarSnippets(query string, sources []SnippetSource, windowLines, budget int) []Snippet {
+	queryTokens := identifierSet(identifierPattern.FindAllString(query, -1))
+
+	if len(queryTokens) == 0 || budget <= 0 || windowLines <= 0 {
+		return nil
+	}
+
+	var candidates []Snippet
+	stride := max(windowLines/2, 1)
+
+	for _, src := range sources {
+		lines := strings.Split(src.Text, "\n")
+		lineTokens := make([][]string, len(lines))
+
+		for i, line := range lines {
+			lineTokens[i] = identifierPattern.FindAllString(line, -1)
+		}
+
+		for start := 0; start < len(lines); start += stride {
+			end := min(start+windowLines, len(lines))
+			score := jaccard(queryTokens, identifierSet(lineTokens[start:end]...))
+
+			if score >= minSnippetScore {
+				candidates = append(candidates, Snippet{
+					URI:       src.URI,
+					StartLine: start,
+					Text:      strings.Join(lines[start:end], "\n"),
+					Score:     score,
+				})
+			}
+
+			if end == len(lines) {
+				break
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+
+	var snippets []Snippet
+	used := 0
+
+	for _, c := range candidates {
+		tokens := EstimateTokens(c.Text)
+
+		if used+tokens > budget || overlapsSnippet(snippets, c, windowLines) {
+			continue
+		}
+
+		snippets = append(snippets, c)
+		used += tokens
+	}
+	return snippets
+}
+
+func overlapsSnippet(snippets []Snippet, c Snippet, windowLines int) bool {
+	for _, s := range snippets {
+		if s.URI == c.URI && c.StartLine < s.StartLine+windowLines && s.StartLine < c.StartLine+windowLines {
+			return true
+		}
+	}
+	return false
+}
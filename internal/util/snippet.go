@@ -0,0 +1,52 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Markers the completion model is asked to put around placeholder values.
+const (
+	PlaceholderStart = "⟦"
+	PlaceholderEnd   = "⟧"
+)
+
+var snippetEscaper = strings.NewReplacer(`\`, `\\`, `$`, `\$`, `}`, `\}`)
+
+// ToSnippet converts text with marked placeholders to LSP snippet syntax,
+// numbering the placeholders in order and escaping everything else. It
+// reports false if text contains no placeholders.
+func ToSnippet(text string) (string, bool) {
+	var b strings.Builder
+	n := 0
+
+	for {
+		start := strings.Index(text, PlaceholderStart)
+		if start == -1 {
+			break
+		}
+
+		end := strings.Index(text[start+len(PlaceholderStart):], PlaceholderEnd)
+		if end == -1 {
+			break
+		}
+
+		name := text[start+len(PlaceholderStart) : start+len(PlaceholderStart)+end]
+		n++
+		b.WriteString(snippetEscaper.Replace(text[:start]))
+		fmt.Fprintf(&b, "${%d:%s}", n, snippetEscaper.Replace(name))
+		text = text[start+len(PlaceholderStart)+end+len(PlaceholderEnd):]
+	}
+
+	if n == 0 {
+		return "", false
+	}
+
+	b.WriteString(snippetEscaper.Replace(text))
+	return b.String(), true
+}
+
+// StripPlaceholders removes the placeholder markers, keeping their contents.
+func StripPlaceholders(text string) string {
+	return strings.NewReplacer(PlaceholderStart, "", PlaceholderEnd, "").Replace(text)
+}
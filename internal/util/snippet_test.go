@@ -0,0 +1,35 @@
+package util
+
+import "testing"
+
+func TestToSnippet(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    string
+		wantSet bool
+	}{
+		{"no placeholders", "foo(a, b)", "", false},
+		{"one placeholder", "foo(⟦name⟧)", "foo(${1:name})", true},
+		{"numbered in order", "⟦a⟧ + ⟦b⟧", "${1:a} + ${2:b}", true},
+		{"escaped text", "$x{⟦y⟧}\\", "\\$x{${1:y}\\}\\\\", true},
+		{"escaped placeholder", "⟦a}b⟧", "${1:a\\}b}", true},
+		{"unterminated", "foo(⟦name", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ToSnippet(tt.text)
+
+			if ok != tt.wantSet || got != tt.want {
+				t.Errorf("ToSnippet(%q) = %q, %v, want %q, %v", tt.text, got, ok, tt.want, tt.wantSet)
+			}
+		})
+	}
+}
+
+func TestStripPlaceholders(t *testing.T) {
+	if got := StripPlaceholders("foo(⟦a⟧, ⟦b⟧)"); got != "foo(a, b)" {
+		t.Errorf("StripPlaceholders() = %q", got)
+	}
+}
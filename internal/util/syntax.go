@@ -0,0 +1,121 @@
+package util
+
+import "strings"
+
+var lineCommentPrefixes = map[string][]string{
+	"python":      {"#"},
+	"ruby":        {"#"},
+	"perl":        {"#"},
+	"r":           {"#"},
+	"elixir":      {"#"},
+	"nix":         {"#"},
+	"bash":        {"#"},
+	"sh":          {"#"},
+	"shellscript": {"#"},
+	"fish":        {"#"},
+	"yaml":        {"#"},
+	"toml":        {"#"},
+	"dockerfile":  {"#"},
+	"make":        {"#"},
+	"lua":         {"--"},
+	"sql":         {"--"},
+	"haskell":     {"--"},
+	"elm":         {"--"},
+	"clojure":     {";"},
+	"scheme":      {";"},
+	"commonlisp":  {";"},
+	"erlang":      {"%"},
+	"latex":       {"%"},
+}
+
+// Languages whose single quotes do not delimit strings, such as Rust
+// lifetimes, OCaml type variables and Haskell primes.
+var noSingleQuoteStrings = map[string]bool{
+	"rust":    true,
+	"ocaml":   true,
+	"haskell": true,
+	"elm":     true,
+}
+
+// Prose and markup languages, where quotes are punctuation rather than string
+// delimiters and there is no default comment syntax.
+var proseLanguages = map[string]bool{
+	"markdown":         true,
+	"plaintext":        true,
+	"text":             true,
+	"gitcommit":        true,
+	"restructuredtext": true,
+	"asciidoc":         true,
+	"org":              true,
+	"latex":            true,
+	"html":             true,
+	"xml":              true,
+}
+
+// ScanLine scans a line up to the cursor and reports whether the cursor is
+// inside a string literal or a comment. Only the line itself is considered,
+// so multi-line strings and block comments opened on earlier lines are not
+// detected.
+func ScanLine(line, languageID string) (inString, inComment bool) {
+	prose := proseLanguages[languageID]
+	prefixes, ok := lineCommentPrefixes[languageID]
+	blockComments := !ok && !prose
+
+	if !ok && !prose {
+		prefixes = []string{"//"}
+	}
+
+	trimmed := strings.TrimSpace(line)
+
+	// Continuation lines of a block comment, as in doc comments.
+	if blockComments && (trimmed == "*" || strings.HasPrefix(trimmed, "* ")) {
+		return false, true
+	}
+
+	quotes := "\"'`"
+
+	if noSingleQuoteStrings[languageID] {
+		quotes = "\"`"
+	}
+
+	if prose {
+		quotes = ""
+	}
+
+	var quote byte
+
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+
+		if quote != 0 {
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+			continue
+		}
+
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(line[i:], prefix) {
+				return false, true
+			}
+		}
+
+		if blockComments && strings.HasPrefix(line[i:], "/*") {
+			end := strings.Index(line[i+2:], "*/")
+
+			if end == -1 {
+				return false, true
+			}
+			i += end + 3
+			continue
+		}
+
+		if strings.IndexByte(quotes, c) != -1 {
+			quote = c
+		}
+	}
+
+	return quote != 0, false
+}
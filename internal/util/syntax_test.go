@@ -0,0 +1,36 @@
+package util
+
+import "testing"
+
+func TestScanLine(t *testing.T) {
+	tests := []struct {
+		line       string
+		languageID string
+		inString   bool
+		inComment  bool
+	}{
+		{`x := "abc `, "go", true, false},
+		{`x := "abc" + `, "go", false, false},
+		{`x := "a\"b `, "go", true, false},
+		{`x := 1 // note `, "go", false, true},
+		{`s := "// not a comment `, "go", true, false},
+		{`/* open `, "go", false, true},
+		{`/* closed */ x `, "go", false, false},
+		{` * doc comment `, "java", false, true},
+		{`x = 'abc `, "python", true, false},
+		{`x = 1 # note `, "python", false, true},
+		{`fn f<'a>(x: &'a str) `, "rust", false, false},
+		{`Let's write the `, "markdown", false, false},
+		{`See "the docs" and http://example.com `, "markdown", false, false},
+		{`It's 100% done `, "latex", false, true},
+		{`Don't `, "plaintext", false, false},
+	}
+
+	for _, tt := range tests {
+		inString, inComment := ScanLine(tt.line, tt.languageID)
+
+		if inString != tt.inString || inComment != tt.inComment {
+			t.Errorf("ScanLine(%q, %s) = %v, %v, want %v, %v", tt.line, tt.languageID, inString, inComment, tt.inString, tt.inComment)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package util
+
+import "strings"
+
+// ContextWindow is the part of a document sent around the cursor when the
+// whole document does not fit the token budget.
+type ContextWindow struct {
+	// Header holds the leading package, import and comment lines of the
+	// document when they are not already part of Before.
+	Header string
+	Before string
+	After  string
+	// OmittedBefore is the number of lines left out between Header and
+	// Before, and OmittedAfter the number left out at the end of After.
+	OmittedBefore int
+	OmittedAfter  int
+}
+
+// Share of the budget the header may use, and share of the rest given to
+// the text before the cursor.
+const (
+	headerBudgetShare = 4
+	beforeBudgetShare = 0.75
+)
+
+// How far a cut may move to land on a block boundary, in lines.
+const blockSnapLines = 12
+
+var headerPrefixes = []string{
+	"package ", "import ", "import(", "from ", "use ", "using ", "require ", "require(",
+	"#include", "#import", "module ", "extern crate ", "namespace ",
+	"//", "#", "/*", "*", "--", "\"\"\"", "'''", "{-", "'use ", "\"use ",
+}
+
+// EstimateTokens gives a rough token count for text, at about four bytes per
+// token.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// BuildContextWindow fits the text before and after the cursor into budget
+// tokens. It keeps the file header and the lines nearest the cursor, cutting
+// at line boundaries and preferably between blocks. A budget of zero or less
+// keeps everything.
+func BuildContextWindow(before, after string, budget int) ContextWindow {
+	if budget <= 0 || EstimateTokens(before)+EstimateTokens(after) <= budget {
+		return ContextWindow{Before: before, After: after}
+	}
+
+	beforeLines := strings.Split(before, "\n")
+	afterLines := strings.Split(after, "\n")
+
+	// The cursor line is never cut.
+	cursorLine := len(beforeLines) - 1
+	ends := headerEnds(beforeLines[:cursorLine])
+	headerEnd := 0
+
+	if len(ends) > 0 {
+		fit := fitLines(beforeLines[:ends[len(ends)-1]], budget/headerBudgetShare, false)
+
+		for _, end := range ends {
+			if end <= fit {
+				headerEnd = end
+			}
+		}
+	}
+	remaining := budget - linesTokens(beforeLines[:headerEnd])
+
+	beforeBudget := int(float64(remaining) * beforeBudgetShare)
+	afterBudget := remaining - beforeBudget
+
+	// Whatever one side does not need goes to the other.
+	if need := linesTokens(afterLines); need < afterBudget {
+		beforeBudget += afterBudget - need
+		afterBudget = need
+	}
+
+	keptBefore := fitLines(beforeLines[headerEnd:cursorLine], beforeBudget-EstimateTokens(beforeLines[cursorLine]), true)
+	beforeStart := cursorLine - keptBefore
+
+	if used := linesTokens(beforeLines[beforeStart:]); used < beforeBudget {
+		afterBudget += beforeBudget - used
+	}
+
+	afterEnd := 1 + fitLines(afterLines[1:], afterBudget-EstimateTokens(afterLines[0]), false)
+
+	if beforeStart > headerEnd {
+		beforeStart = snapBlockStart(beforeLines, beforeStart, cursorLine)
+	}
+
+	if afterEnd < len(afterLines) {
+		afterEnd = snapBlockEnd(afterLines, afterEnd)
+	}
+
+	window := ContextWindow{
+		Before:        strings.Join(beforeLines[beforeStart:], "\n"),
+		After:         strings.Join(afterLines[:afterEnd], "\n"),
+		OmittedBefore: beforeStart - headerEnd,
+		OmittedAfter:  len(afterLines) - afterEnd,
+	}
+
+	if window.OmittedBefore == 0 {
+		window.Before = strings.Join(beforeLines, "\n")
+	} else if headerEnd > 0 {
+		window.Header = strings.Join(beforeLines[:headerEnd], "\n")
+	}
+	return window
+}
+
+// Delimiters of block comments and docstrings that may span several header
+// lines.
+var blockComments = [][2]string{
+	{"/*", "*/"}, {`"""`, `"""`}, {"'''", "'''"}, {"{-", "-}"}, {"--[[", "]]"},
+}
+
+// headerEnds returns the line counts at which the file header, made of
+// package and import declarations, comments and blank lines, may end. The
+// last one is the whole header. Counts inside import blocks, block comments
+// and docstrings are left out, so cutting at any of them keeps every block
+// closed.
+func headerEnds(lines []string) []int {
+	var ends []int
+	inBlock := false
+	closer := ""
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case closer != "":
+			if strings.Contains(trimmed, closer) {
+				closer = ""
+			}
+		case inBlock:
+			inBlock = !strings.HasPrefix(trimmed, ")") && !strings.HasPrefix(trimmed, "}")
+		case trimmed == "":
+			continue
+		case hasHeaderPrefix(trimmed):
+			closer = openedBlockComment(trimmed)
+			inBlock = strings.HasSuffix(trimmed, "(") || strings.HasSuffix(trimmed, "{")
+		default:
+			return ends
+		}
+
+		if closer == "" && !inBlock {
+			ends = append(ends, i+1)
+		}
+	}
+	return ends
+}
+
+// openedBlockComment returns the delimiter that closes a block comment or
+// docstring line starts and leaves open, or "" if there is none.
+func openedBlockComment(line string) string {
+	for _, c := range blockComments {
+		if strings.HasPrefix(line, c[0]) && !strings.Contains(line[len(c[0]):], c[1]) {
+			return c[1]
+		}
+	}
+	return ""
+}
+
+func hasHeaderPrefix(line string) bool {
+	for _, prefix := range headerPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func linesTokens(lines []string) int {
+	tokens := 0
+
+	for _, line := range lines {
+		tokens += EstimateTokens(line) + 1
+	}
+	return tokens
+}
+
+// fitLines returns how many lines fit in budget tokens, counted from the end
+// of lines when fromEnd is set and from the start otherwise.
+func fitLines(lines []string, budget int, fromEnd bool) int {
+	used := 0
+
+	for n := range lines {
+		i := n
+
+		if fromEnd {
+			i = len(lines) - 1 - n
+		}
+
+		used += EstimateTokens(lines[i]) + 1
+
+		if used > budget {
+			return n
+		}
+	}
+	return len(lines)
+}
+
+// snapBlockStart moves a cut forward, dropping a few more lines, so the
+// window starts at the beginning of a block rather than inside one.
+func snapBlockStart(lines []string, start, limit int) int {
+	for i := start; i < min(start+blockSnapLines, limit); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			return i + 1
+		}
+
+		if i > start && indentWidth(lines[i]) == 0 {
+			return i
+		}
+	}
+	return start
+}
+
+// snapBlockEnd moves a cut backward so the window ends at the end of a block.
+func snapBlockEnd(lines []string, end int) int {
+	for i := end - 1; i > max(end-blockSnapLines, 1); i-- {
+		if strings.TrimSpace(lines[i]) == "" {
+			return i
+		}
+	}
+	return end
+}
+
+func indentWidth(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,109 @@
+package util
+
+import (
+	"strings"
+	"testing"
+)
+
+func longBody(lines int) string {
+	return strings.Repeat("    x = compute_something_long(argument_one, argument_two)\n", lines)
+}
+
+func TestBuildContextWindow(t *testing.T) {
+	tests := []struct {
+		name       string
+		before     string
+		after      string
+		budget     int
+		wantHeader string
+		wantBefore string
+		wantAfter  string
+		omitted    bool
+	}{
+		{
+			name:       "fits",
+			before:     "package main\n\nfunc f() {\n\t",
+			after:      "\n}",
+			budget:     100,
+			wantBefore: "package main\n\nfunc f() {\n\t",
+			wantAfter:  "\n}",
+		},
+		{
+			name:       "no budget",
+			before:     longBody(100),
+			budget:     0,
+			wantBefore: longBody(100),
+		},
+		{
+			name:       "python docstring header",
+			before:     "\"\"\"Module doc.\n\nMore prose here.\n\"\"\"\nimport os\nimport sys\n\ndef f():\n" + longBody(60),
+			budget:     200,
+			wantHeader: "\"\"\"Module doc.\n\nMore prose here.\n\"\"\"\nimport os\nimport sys",
+			omitted:    true,
+		},
+		{
+			name:       "go import block header",
+			before:     "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc f() {\n" + longBody(60),
+			budget:     200,
+			wantHeader: "package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)",
+			omitted:    true,
+		},
+		{
+			name:       "c block comment header",
+			before:     "/*\n * Copyright\n * Licensed\n */\n#include <stdio.h>\n\nint main() {\n" + longBody(60),
+			budget:     200,
+			wantHeader: "/*\n * Copyright\n * Licensed\n */\n#include <stdio.h>",
+			omitted:    true,
+		},
+		{
+			name:       "header over its share",
+			before:     "\"\"\"\n" + strings.Repeat("prose line of the module documentation\n", 40) + "\"\"\"\nimport os\n\ndef f():\n" + longBody(60),
+			budget:     200,
+			wantHeader: "",
+			omitted:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := BuildContextWindow(tt.before, tt.after, tt.budget)
+
+			if w.Header != tt.wantHeader {
+				t.Errorf("Header = %q, want %q", w.Header, tt.wantHeader)
+			}
+
+			if (w.OmittedBefore > 0) != tt.omitted {
+				t.Errorf("OmittedBefore = %d, want omitted %v", w.OmittedBefore, tt.omitted)
+			}
+
+			if tt.wantBefore != "" && w.Before != tt.wantBefore {
+				t.Errorf("Before = %q, want %q", w.Before, tt.wantBefore)
+			}
+
+			if tt.wantAfter != "" && w.After != tt.wantAfter {
+				t.Errorf("After = %q, want %q", w.After, tt.wantAfter)
+			}
+
+			if !strings.HasSuffix(tt.before, w.Before) {
+				t.Errorf("Before %q is not the end of the text before the cursor", w.Before)
+			}
+
+			if tt.budget > 0 && EstimateTokens(w.Header)+EstimateTokens(w.Before)+EstimateTokens(w.After) > tt.budget+10 {
+				t.Errorf("window exceeds budget %d", tt.budget)
+			}
+		})
+	}
+}
+
+func TestBuildContextWindowKeepsCursorLine(t *testing.T) {
+	cursorLine := "    result = " + strings.Repeat("a", 400)
+	w := BuildContextWindow(longBody(20)+cursorLine, "\n"+longBody(20), 50)
+
+	if !strings.HasSuffix(w.Before, cursorLine) {
+		t.Errorf("cursor line cut from Before: %q", w.Before)
+	}
+
+	if w.OmittedBefore == 0 || w.OmittedAfter == 0 {
+		t.Errorf("expected lines omitted on both sides, got %d and %d", w.OmittedBefore, w.OmittedAfter)
+	}
+}